@@ -0,0 +1,282 @@
+package toolkit
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// textUnmarshalerType is used to find fields that decode themselves
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// bindSource is where the values of fields with one struct tag come from
+type bindSource struct {
+	tag    string
+	lookup func(name string) ([]string, bool)
+}
+
+// Bind fills the struct pointed to by dst from the request, using struct tags to name the
+// value of each field:
+//
+//	type ListParams struct {
+//		UserID int           `path:"id"`
+//		Sort   string        `query:"sort" enum:"asc,desc" default:"asc"`
+//		Tags   []string      `query:"tag"`
+//		Since  time.Time     `query:"since" layout:"2006-01-02"`
+//		Wait   time.Duration `query:"wait"`
+//		Token  string        `header:"X-Token,required"`
+//		Note   string        `form:"note"`
+//	}
+//
+// path reads r.PathValue, query the URL query, header the request headers, and form the
+// body of a url-encoded or already parsed multipart form. Strings, booleans, numbers,
+// durations, times (RFC 3339 unless a layout is given), pointers, slices of these and
+// types that implement encoding.TextUnmarshaler are supported. Embedded structs are
+// bound too. Fields without a value keep theirs, or get their default.
+//
+// Errors are *RequestError: 400 for values that can't be converted, and 422 for missing
+// required values and values outside an enum.
+func (t *Tools) Bind(r *http.Request, dst any) (err error) {
+	_, span := t.startSpan(r.Context(), "toolkit.Bind")
+	defer func() { endSpan(span, err) }()
+
+	sources := []bindSource{
+		{tag: "path", lookup: func(name string) ([]string, bool) {
+			v := r.PathValue(name)
+			return []string{v}, v != ""
+		}},
+		{tag: "query", lookup: func(name string) ([]string, bool) {
+			v, ok := r.URL.Query()[name]
+			return v, ok
+		}},
+		{tag: "header", lookup: func(name string) ([]string, bool) {
+			v := r.Header.Values(name)
+			return v, len(v) > 0
+		}},
+	}
+
+	if hasTag(reflect.TypeOf(dst), "form") {
+		if err := r.ParseForm(); err != nil {
+			return &RequestError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("form can't be read: %s", err)}
+		}
+		sources = append(sources, bindSource{tag: "form", lookup: func(name string) ([]string, bool) {
+			if v, ok := r.PostForm[name]; ok {
+				return v, true
+			}
+			if r.MultipartForm != nil {
+				v, ok := r.MultipartForm.Value[name]
+				return v, ok
+			}
+			return nil, false
+		}})
+	}
+
+	return bindFields(dst, sources...)
+}
+
+// hasTag reports whether a struct type, or a pointer to one, has a field with the given tag
+func hasTag(typ reflect.Type, tag string) bool {
+	if typ == nil {
+		return false
+	}
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if _, ok := field.Tag.Lookup(tag); ok {
+			return true
+		}
+		if field.Anonymous && hasTag(field.Type, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// bindValues sets the fields of the struct pointed to by dst that have the given tag,
+// using lookup to find the values for each tag name. Fields without a value are left alone.
+func bindValues(dst any, tag string, lookup func(name string) ([]string, bool)) error {
+	return bindFields(dst, bindSource{tag: tag, lookup: lookup})
+}
+
+// bindFields sets the fields of the struct pointed to by dst from the first source whose
+// tag they have
+func bindFields(dst any, sources ...bindSource) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New("bind destination must be a non-nil pointer to a struct")
+	}
+	return bindStruct(v.Elem(), sources)
+}
+
+// bindStruct binds the fields of a struct value, and of its embedded structs
+func bindStruct(v reflect.Value, sources []bindSource) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := bindStruct(v.Field(i), sources); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		for _, src := range sources {
+			tag, ok := field.Tag.Lookup(src.tag)
+			if !ok {
+				continue
+			}
+			if err := bindField(v.Field(i), field, tag, src); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// bindField sets one field from its source, applying the options of its tags
+func bindField(f reflect.Value, field reflect.StructField, tag string, src bindSource) error {
+	name, options, _ := strings.Cut(tag, ",")
+	if name == "-" {
+		return nil
+	}
+	if name == "" {
+		name = field.Name
+	}
+
+	values, ok := src.lookup(name)
+	if !ok || len(values) == 0 {
+		if def, ok := field.Tag.Lookup("default"); ok {
+			values = []string{def}
+		} else if slices.Contains(strings.Split(options, ","), "required") {
+			return &RequestError{Status: http.StatusUnprocessableEntity, Field: name, Msg: fmt.Sprintf("field %q is required", name)}
+		} else {
+			return nil
+		}
+	}
+
+	if enum, ok := field.Tag.Lookup("enum"); ok {
+		allowed := strings.Split(enum, ",")
+		for _, value := range values {
+			if !slices.Contains(allowed, value) {
+				return &RequestError{Status: http.StatusUnprocessableEntity, Field: name, Msg: fmt.Sprintf("field %q: must be one of %s", name, strings.Join(allowed, ", "))}
+			}
+		}
+	}
+
+	if err := setFieldValue(f, values, field.Tag.Get("layout")); err != nil {
+		return &RequestError{Status: http.StatusBadRequest, Field: name, Msg: fmt.Sprintf("field %q: %s", name, err)}
+	}
+	return nil
+}
+
+// setFieldValue converts values to the type of f and sets it. Slices get every value,
+// other types the first one. Times are parsed with layout, or RFC 3339 if it's empty.
+func setFieldValue(f reflect.Value, values []string, layout string) error {
+	if f.Kind() == reflect.Pointer {
+		elem := reflect.New(f.Type().Elem())
+		if err := setFieldValue(elem.Elem(), values, layout); err != nil {
+			return err
+		}
+		f.Set(elem)
+		return nil
+	}
+
+	if f.Kind() == reflect.Slice && f.Type().Elem().Kind() != reflect.Uint8 && !reflect.PointerTo(f.Type()).Implements(textUnmarshalerType) {
+		slice := reflect.MakeSlice(f.Type(), len(values), len(values))
+		for i, s := range values {
+			if err := setFieldValue(slice.Index(i), []string{s}, layout); err != nil {
+				return err
+			}
+		}
+		f.Set(slice)
+		return nil
+	}
+
+	return setScalarValue(f, values[0], layout)
+}
+
+// setScalarValue converts s to the type of f and sets it
+func setScalarValue(f reflect.Value, s string, layout string) error {
+	switch f.Type() {
+	case reflect.TypeOf(time.Time{}):
+		if layout == "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return fmt.Errorf("must be a time in RFC 3339 format")
+			}
+			f.Set(reflect.ValueOf(t))
+			return nil
+		}
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return fmt.Errorf("must be a time in the format %s", layout)
+		}
+		f.Set(reflect.ValueOf(t))
+		return nil
+
+	case reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("must be a duration such as 1m30s")
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+
+	if f.CanAddr() {
+		if u, ok := f.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return u.UnmarshalText([]byte(s))
+		}
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("must be a boolean")
+		}
+		f.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+		f.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a non-negative integer")
+		}
+		f.SetUint(n)
+
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		f.SetFloat(n)
+
+	default:
+		return fmt.Errorf("unsupported type %s", f.Type())
+	}
+	return nil
+}
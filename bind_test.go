@@ -0,0 +1,152 @@
+package toolkit
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindTarget struct {
+	Title    string    `form:"title"`
+	Count    int       `form:"count"`
+	Ratio    float64   `form:"ratio"`
+	Public   bool      `form:"public"`
+	Tags     []string  `form:"tags"`
+	IDs      []uint    `form:"ids"`
+	Album    *int      `form:"album"`
+	Taken    time.Time `form:"taken"`
+	IP       net.IP    `form:"ip"`
+	Ignored  string    `form:"-"`
+	Untagged string
+}
+
+func TestBindValues(t *testing.T) {
+	values := map[string][]string{
+		"title":  {"Holiday"},
+		"count":  {"3"},
+		"ratio":  {"1.5"},
+		"public": {"true"},
+		"tags":   {"beach", "sun"},
+		"ids":    {"1", "2"},
+		"album":  {"7"},
+		"taken":  {"2024-06-01T10:00:00Z"},
+		"ip":     {"192.168.1.1"},
+	}
+	lookup := func(name string) ([]string, bool) {
+		v, ok := values[name]
+		return v, ok
+	}
+
+	var dst bindTarget
+	if err := bindValues(&dst, "form", lookup); err != nil {
+		t.Fatal(err)
+	}
+
+	if dst.Title != "Holiday" || dst.Count != 3 || dst.Ratio != 1.5 || !dst.Public {
+		t.Errorf("unexpected scalar values %+v", dst)
+	}
+	if len(dst.Tags) != 2 || dst.Tags[1] != "sun" || len(dst.IDs) != 2 || dst.IDs[1] != 2 {
+		t.Errorf("unexpected slices %v %v", dst.Tags, dst.IDs)
+	}
+	if dst.Album == nil || *dst.Album != 7 {
+		t.Errorf("unexpected pointer %v", dst.Album)
+	}
+	if !dst.Taken.Equal(time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected time %s", dst.Taken)
+	}
+	if dst.IP.String() != "192.168.1.1" {
+		t.Errorf("unexpected text unmarshaler value %s", dst.IP)
+	}
+
+	values["count"] = []string{"three"}
+	if err := bindValues(&dst, "form", lookup); err == nil {
+		t.Error("expected an error for a bad integer")
+	}
+
+	if err := bindValues(dst, "form", lookup); err == nil {
+		t.Error("expected an error for a non-pointer destination")
+	}
+}
+
+type pageParams struct {
+	Limit int `query:"limit" default:"20"`
+}
+
+type listParams struct {
+	pageParams
+	UserID int           `path:"id"`
+	Sort   string        `query:"sort" enum:"asc,desc" default:"asc"`
+	Tags   []string      `query:"tag"`
+	Since  time.Time     `query:"since" layout:"2006-01-02"`
+	Wait   time.Duration `query:"wait"`
+	Token  string        `header:"X-Token,required"`
+	Note   string        `form:"note"`
+}
+
+func TestTools_Bind(t *testing.T) {
+	var testTools Tools
+
+	bind := func(target, token, body string) (listParams, error) {
+		t.Helper()
+
+		var params listParams
+		var bindErr error
+		mux := http.NewServeMux()
+		mux.HandleFunc("/users/{id}/items", func(w http.ResponseWriter, r *http.Request) {
+			bindErr = testTools.Bind(r, &params)
+		})
+
+		request := httptest.NewRequest("POST", target, strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if token != "" {
+			request.Header.Set("X-Token", token)
+		}
+		mux.ServeHTTP(httptest.NewRecorder(), request)
+		return params, bindErr
+	}
+
+	params, err := bind("/users/7/items?sort=desc&tag=a&tag=b&since=2024-06-01&wait=1m30s", "secret", "note=hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.UserID != 7 || params.Sort != "desc" || len(params.Tags) != 2 || params.Token != "secret" || params.Note != "hello" {
+		t.Errorf("unexpected params %+v", params)
+	}
+	if !params.Since.Equal(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)) || params.Wait != 90*time.Second {
+		t.Errorf("unexpected time values %s %s", params.Since, params.Wait)
+	}
+	if params.Limit != 20 {
+		t.Errorf("expected the default limit of the embedded struct, got %d", params.Limit)
+	}
+
+	errorTests := []struct {
+		name           string
+		target         string
+		token          string
+		expectedStatus int
+		expectedField  string
+	}{
+		{name: "missing required header", target: "/users/7/items", expectedStatus: http.StatusUnprocessableEntity, expectedField: "X-Token"},
+		{name: "value outside enum", target: "/users/7/items?sort=up", token: "x", expectedStatus: http.StatusUnprocessableEntity, expectedField: "sort"},
+		{name: "bad path value", target: "/users/seven/items", token: "x", expectedStatus: http.StatusBadRequest, expectedField: "id"},
+		{name: "bad date", target: "/users/7/items?since=yesterday", token: "x", expectedStatus: http.StatusBadRequest, expectedField: "since"},
+		{name: "bad duration", target: "/users/7/items?wait=soon", token: "x", expectedStatus: http.StatusBadRequest, expectedField: "wait"},
+	}
+
+	for _, e := range errorTests {
+		_, err := bind(e.target, e.token, "")
+
+		var requestErr *RequestError
+		if !errors.As(err, &requestErr) {
+			t.Errorf("%s: expected a *RequestError, got %v", e.name, err)
+			continue
+		}
+		if requestErr.StatusCode() != e.expectedStatus || requestErr.Field != e.expectedField {
+			t.Errorf("%s: unexpected error %+v", e.name, requestErr)
+		}
+	}
+}
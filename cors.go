@@ -0,0 +1,200 @@
+package toolkit
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCORSMethods are the methods allowed when CORSOptions.AllowedMethods is empty
+var defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+// CORSOptions configures the CORS middleware
+type CORSOptions struct {
+	// AllowedOrigins are the origins allowed to call, such as "https://app.example.com".
+	// "https://*.example.com" allows every subdomain, and "*" every origin
+	AllowedOrigins []string
+	// AllowOrigin, if set, is asked about origins that aren't in AllowedOrigins
+	AllowOrigin func(r *http.Request, origin string) bool
+	// AllowedMethods defaults to GET, HEAD and POST
+	AllowedMethods []string
+	// AllowedHeaders are the request headers clients may send, besides the ones that are
+	// always allowed. "*" allows any header
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts may read, besides the ones that
+	// always can be
+	ExposedHeaders []string
+	// AllowCredentials lets clients send cookies and authorization headers
+	AllowCredentials bool
+	// MaxAge is how long clients may cache a preflight response. Zero leaves it to the
+	// client, and a negative value disables caching
+	MaxAge time.Duration
+}
+
+// originPattern is an allowed origin, with a wildcard in the middle or none
+type originPattern struct {
+	prefix, suffix string
+	wildcard       bool
+}
+
+// match reports whether origin matches the pattern
+func (p originPattern) match(origin string) bool {
+	if !p.wildcard {
+		return origin == p.prefix
+	}
+	if len(origin) <= len(p.prefix)+len(p.suffix) || !strings.HasPrefix(origin, p.prefix) || !strings.HasSuffix(origin, p.suffix) {
+		return false
+	}
+	// The wildcard only stands for subdomains
+	sub := origin[len(p.prefix) : len(origin)-len(p.suffix)]
+	return !strings.ContainsAny(sub, "/:@?#")
+}
+
+// CORS returns middleware that lets scripts from other origins call the handler, as
+// allowed by opts. Preflight requests are answered with a 204 without calling the handler,
+// and Vary headers are added so caches keep responses for different origins apart. It
+// panics if an allowed origin has more than one wildcard.
+func (t *Tools) CORS(opts CORSOptions) func(http.Handler) http.Handler {
+	var patterns []originPattern
+	allowAll := false
+	for _, origin := range opts.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		switch strings.Count(origin, "*") {
+		case 0:
+			patterns = append(patterns, originPattern{prefix: origin})
+		case 1:
+			if origin == "*" {
+				allowAll = true
+				continue
+			}
+			prefix, suffix, _ := strings.Cut(origin, "*")
+			patterns = append(patterns, originPattern{prefix: prefix, suffix: suffix, wildcard: true})
+		default:
+			panic(fmt.Sprintf("toolkit: allowed origin %q has more than one wildcard", origin))
+		}
+	}
+
+	methods := opts.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	allowAllHeaders := slices.Contains(opts.AllowedHeaders, "*")
+	allowedHeaders := make([]string, len(opts.AllowedHeaders))
+	for i, header := range opts.AllowedHeaders {
+		allowedHeaders[i] = strings.ToLower(header)
+	}
+
+	allowed := func(r *http.Request, origin string) bool {
+		if allowAll {
+			return true
+		}
+		lower := strings.ToLower(origin)
+		for _, p := range patterns {
+			if p.match(lower) {
+				return true
+			}
+		}
+		return opts.AllowOrigin != nil && opts.AllowOrigin(r, origin)
+	}
+
+	setOrigin := func(header http.Header, origin string) {
+		// With credentials the origin must be named, even when every origin is allowed
+		if allowAll && !opts.AllowCredentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if opts.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := w.Header()
+			origin := r.Header.Get("Origin")
+			requestMethod := r.Header.Get("Access-Control-Request-Method")
+
+			if r.Method == http.MethodOptions && requestMethod != "" {
+				addVary(header, "Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers")
+
+				// A preflight that isn't allowed gets no CORS headers, and the browser stops there
+				requestHeaders := parseHeaderList(r.Header.Values("Access-Control-Request-Headers"))
+				if origin != "" && allowed(r, origin) && slices.Contains(methods, requestMethod) &&
+					(allowAllHeaders || allHeadersAllowed(requestHeaders, allowedHeaders)) {
+					setOrigin(header, origin)
+					header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+					if len(requestHeaders) > 0 {
+						header.Set("Access-Control-Allow-Headers", strings.Join(requestHeaders, ", "))
+					}
+					switch {
+					case opts.MaxAge > 0:
+						header.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge/time.Second)))
+					case opts.MaxAge < 0:
+						header.Set("Access-Control-Max-Age", "0")
+					}
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			addVary(header, "Origin")
+			if origin != "" && allowed(r, origin) {
+				setOrigin(header, origin)
+				if len(opts.ExposedHeaders) > 0 {
+					header.Set("Access-Control-Expose-Headers", strings.Join(opts.ExposedHeaders, ", "))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// splitHeaderList splits comma-separated header values into names
+func splitHeaderList(values []string) []string {
+	var names []string
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// parseHeaderList splits comma-separated header values into lower-case names
+func parseHeaderList(values []string) []string {
+	names := splitHeaderList(values)
+	for i, name := range names {
+		names[i] = strings.ToLower(name)
+	}
+	return names
+}
+
+// allHeadersAllowed reports whether every requested header is allowed
+func allHeadersAllowed(requested, allowed []string) bool {
+	for _, name := range requested {
+		if !slices.Contains(allowed, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// addVary adds names to the Vary header, keeping the names already in it
+func addVary(header http.Header, names ...string) {
+	existing := parseHeaderList(header.Values("Vary"))
+	if slices.Contains(existing, "*") {
+		return
+	}
+	for _, name := range names {
+		if !slices.Contains(existing, strings.ToLower(name)) {
+			header.Add("Vary", name)
+			existing = append(existing, strings.ToLower(name))
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var corsTests = []struct {
+	name                string
+	opts                CORSOptions
+	origin              string
+	expectedOrigin      string
+	expectedCredentials bool
+}{
+	{name: "exact", opts: CORSOptions{AllowedOrigins: []string{"https://app.example.com"}}, origin: "https://app.example.com", expectedOrigin: "https://app.example.com"},
+	{name: "exact, other case", opts: CORSOptions{AllowedOrigins: []string{"https://App.example.com"}}, origin: "https://app.EXAMPLE.com", expectedOrigin: "https://app.EXAMPLE.com"},
+	{name: "not allowed", opts: CORSOptions{AllowedOrigins: []string{"https://app.example.com"}}, origin: "https://evil.com"},
+	{name: "subdomain", opts: CORSOptions{AllowedOrigins: []string{"https://*.example.com"}}, origin: "https://a.b.example.com", expectedOrigin: "https://a.b.example.com"},
+	{name: "subdomain, apex", opts: CORSOptions{AllowedOrigins: []string{"https://*.example.com"}}, origin: "https://example.com"},
+	{name: "subdomain, lookalike", opts: CORSOptions{AllowedOrigins: []string{"https://*.example.com"}}, origin: "https://evil.com/.example.com"},
+	{name: "subdomain, other scheme", opts: CORSOptions{AllowedOrigins: []string{"https://*.example.com"}}, origin: "http://a.example.com"},
+	{name: "any", opts: CORSOptions{AllowedOrigins: []string{"*"}}, origin: "https://anyone.org", expectedOrigin: "*"},
+	{name: "any with credentials", opts: CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true}, origin: "https://anyone.org", expectedOrigin: "https://anyone.org", expectedCredentials: true},
+	{name: "callback", opts: CORSOptions{AllowOrigin: func(r *http.Request, origin string) bool {
+		return strings.HasSuffix(origin, ".localhost:3000")
+	}}, origin: "http://dev.localhost:3000", expectedOrigin: "http://dev.localhost:3000"},
+}
+
+func TestTools_CORS(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range corsTests {
+		called := false
+		handler := testTools.CORS(e.opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+
+		request := httptest.NewRequest("GET", "/items", nil)
+		request.Header.Set("Origin", e.origin)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, request)
+
+		if !called {
+			t.Errorf("%s: expected the handler to be called", e.name)
+		}
+		if origin := rr.Header().Get("Access-Control-Allow-Origin"); origin != e.expectedOrigin {
+			t.Errorf("%s: expected allowed origin %q, got %q", e.name, e.expectedOrigin, origin)
+		}
+		if credentials := rr.Header().Get("Access-Control-Allow-Credentials") == "true"; credentials != e.expectedCredentials {
+			t.Errorf("%s: expected credentials %v, got %v", e.name, e.expectedCredentials, credentials)
+		}
+		if rr.Header().Get("Vary") != "Origin" {
+			t.Errorf("%s: expected Vary: Origin, got %v", e.name, rr.Header().Values("Vary"))
+		}
+	}
+}
+
+var corsPreflightTests = []struct {
+	name            string
+	method          string
+	headers         string
+	expectedAllowed bool
+	expectedHeaders string
+}{
+	{name: "allowed", method: "PUT", headers: "Content-Type, X-Request-ID", expectedAllowed: true, expectedHeaders: "content-type, x-request-id"},
+	{name: "no headers", method: "DELETE", expectedAllowed: true},
+	{name: "method not allowed", method: "PATCH"},
+	{name: "header not allowed", method: "PUT", headers: "Content-Type, X-Secret"},
+}
+
+func TestTools_CORSPreflight(t *testing.T) {
+	var testTools Tools
+	opts := CORSOptions{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET", "PUT", "DELETE"},
+		AllowedHeaders: []string{"Content-Type", "X-Request-ID"},
+		MaxAge:         10 * time.Minute,
+	}
+	handler := testTools.CORS(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the handler must not be called for a preflight")
+	}))
+
+	for _, e := range corsPreflightTests {
+		request := httptest.NewRequest("OPTIONS", "/items/1", nil)
+		request.Header.Set("Origin", "https://app.example.com")
+		request.Header.Set("Access-Control-Request-Method", e.method)
+		if e.headers != "" {
+			request.Header.Set("Access-Control-Request-Headers", e.headers)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, request)
+
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("%s: expected status %d, got %d", e.name, http.StatusNoContent, rr.Code)
+		}
+		if allowed := rr.Header().Get("Access-Control-Allow-Origin") != ""; allowed != e.expectedAllowed {
+			t.Errorf("%s: expected allowed %v, got %v", e.name, e.expectedAllowed, allowed)
+		}
+		if vary := strings.Join(rr.Header().Values("Vary"), ", "); vary != "Origin, Access-Control-Request-Method, Access-Control-Request-Headers" {
+			t.Errorf("%s: unexpected Vary %s", e.name, vary)
+		}
+		if !e.expectedAllowed {
+			continue
+		}
+		if rr.Header().Get("Access-Control-Allow-Methods") != "GET, PUT, DELETE" || rr.Header().Get("Access-Control-Max-Age") != "600" {
+			t.Errorf("%s: unexpected headers %v", e.name, rr.Header())
+		}
+		if headers := rr.Header().Get("Access-Control-Allow-Headers"); headers != e.expectedHeaders {
+			t.Errorf("%s: expected allowed headers %q, got %q", e.name, e.expectedHeaders, headers)
+		}
+	}
+}
+
+func TestTools_CORSWriteJSON(t *testing.T) {
+	var testTools Tools
+	opts := CORSOptions{AllowedOrigins: []string{"https://app.example.com"}, ExposedHeaders: []string{"Link"}}
+
+	handler := testTools.CORS(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers := http.Header{}
+		headers.Set("Vary", "Accept-Encoding, origin")
+		headers.Set("Link", `</items?page=2>; rel="next"`)
+		_ = testTools.WriteJSON(w, http.StatusOK, "ok", headers)
+	}))
+
+	request := httptest.NewRequest("GET", "/items", nil)
+	request.Header.Set("Origin", "https://app.example.com")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, request)
+
+	if vary := strings.Join(rr.Header().Values("Vary"), ", "); vary != "Origin, Accept-Encoding" {
+		t.Errorf("expected the Vary headers to be merged, got %s", vary)
+	}
+	if rr.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" || rr.Header().Get("Access-Control-Expose-Headers") != "Link" {
+		t.Errorf("unexpected CORS headers %v", rr.Header())
+	}
+}
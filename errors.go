@@ -0,0 +1,31 @@
+package toolkit
+
+import "net/http"
+
+// RequestError is a problem with a request, returned by ReadJSON, Bind and the other
+// helpers that read requests. ErrorJSON sends its status when no status is given.
+type RequestError struct {
+	// Status is the HTTP status code to send, such as 400 or 422
+	Status int
+	// Field is the name of the field or parameter at fault, if there is one
+	Field string
+	Msg   string
+}
+
+// Error implements the error interface
+func (e *RequestError) Error() string {
+	return e.Msg
+}
+
+// StatusCode returns the HTTP status code to send for the error
+func (e *RequestError) StatusCode() int {
+	if e.Status == 0 {
+		return http.StatusBadRequest
+	}
+	return e.Status
+}
+
+// statusCoder is implemented by errors that know which HTTP status code to send
+type statusCoder interface {
+	StatusCode() int
+}
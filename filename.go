@@ -0,0 +1,185 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxFilenameLength is the longest file name most file systems accept, in bytes
+const maxFilenameLength = 255
+
+// maxExtensionLength is the longest extension SanitizeFilename keeps, without the dot
+const maxExtensionLength = 16
+
+// ErrFileExists is returned by UploadFiles when a file already exists and the
+// collision policy is CollisionFail
+var ErrFileExists = errors.New("file already exists")
+
+// CollisionPolicy decides what UploadFiles does when a file that isn't renamed
+// has the same name as an existing file
+type CollisionPolicy int
+
+const (
+	// CollisionOverwrite replaces the existing file
+	CollisionOverwrite CollisionPolicy = iota
+	// CollisionSuffix keeps the existing file and adds -2, -3... to the new name
+	CollisionSuffix
+	// CollisionFail keeps the existing file and returns ErrFileExists
+	CollisionFail
+)
+
+// windowsReservedNames are device names that can't be used as file names on Windows, with any extension
+var windowsReservedNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true, "com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true, "lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// SanitizeFilename returns a version of name that is safe to write in a directory on any
+// platform. Directories are stripped, the name is turned into a slug with Slugify rules, and
+// the extension is kept in lower case. Windows device names get a "-file" suffix, and names
+// with nothing usable left become "file".
+func (t *Tools) SanitizeFilename(name string) (string, error) {
+
+	if name == "" {
+		return "", errors.New("empty string is not permitted")
+	}
+
+	// Treat both kinds of slashes as separators, whatever the platform, and drop the directories
+	base := path.Base(strings.ReplaceAll(name, `\`, "/"))
+
+	ext := path.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	if stem == "" {
+		// A dot file like ".env": the "extension" is the name
+		stem, ext = ext, ""
+	}
+	ext = sanitizeExtension(ext)
+
+	slug, err := t.SlugifyWithOptions(stem, SlugOptions{MaxLength: maxFilenameLength - len(ext)})
+	if err != nil {
+		slug = "file"
+	}
+
+	if windowsReservedNames[slug] {
+		slug += "-file"
+	}
+	return slug + ext, nil
+}
+
+// clientExtension returns the extension of a file name sent by a client, cleaned up with
+// sanitizeExtension. Both kinds of slashes are taken as separators, as in SanitizeFilename.
+func clientExtension(name string) string {
+	base := path.Base(strings.ReplaceAll(name, `\`, "/"))
+	if ext := path.Ext(base); ext != base {
+		return sanitizeExtension(ext)
+	}
+	return ""
+}
+
+// sanitizeExtension lower cases an extension and keeps only ASCII letters and digits.
+// It returns the extension with its dot, or an empty string if nothing is left.
+func sanitizeExtension(ext string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimPrefix(ext, ".")) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+
+	clean := b.String()
+	if clean == "" {
+		return ""
+	}
+	if len(clean) > maxExtensionLength {
+		clean = clean[:maxExtensionLength]
+	}
+	return "." + clean
+}
+
+// stagedUploadPrefix and stagedUploadSuffix name the files uploads are written to before
+// they get their final name, so the janitor can tell files left by failed requests apart
+// from finished uploads
+const (
+	stagedUploadPrefix = ".upload-"
+	stagedUploadSuffix = ".part"
+)
+
+// createStagedUpload creates a new, uniquely named file in dir for an upload to be written to
+func (t *Tools) createStagedUpload(dir string) (*os.File, error) {
+	for attempt := 0; ; attempt++ {
+		id, err := t.GenerateRandomString(12, slugSuffixAlphabet)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(filepath.Join(dir, stagedUploadPrefix+id+stagedUploadSuffix), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) && attempt < 5 {
+			continue
+		}
+		return f, err
+	}
+}
+
+// placeUpload gives the staged file its final name in dir, following
+// t.UploadCollisionPolicy if name already exists. It returns the name that was used,
+// and the size of the file it replaced, if any.
+func (t *Tools) placeUpload(dir, staged, name string) (string, int64, error) {
+	// Linking doesn't replace an existing file, so the name is only taken if it's free
+	link := func(candidate string) error {
+		if err := os.Link(staged, filepath.Join(dir, candidate)); err != nil {
+			return err
+		}
+		// A staged file that can't be removed is left for the janitor
+		_ = os.Remove(staged)
+		return nil
+	}
+
+	switch t.UploadCollisionPolicy {
+	case CollisionFail:
+		err := link(name)
+		if os.IsExist(err) {
+			return "", 0, fmt.Errorf("%w: %s", ErrFileExists, name)
+		}
+		return name, 0, err
+
+	case CollisionSuffix:
+		ext := filepath.Ext(name)
+		stem := strings.TrimSuffix(name, ext)
+		exists := func(candidate string) (bool, error) {
+			_, err := os.Lstat(filepath.Join(dir, candidate+ext))
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+			return err == nil, err
+		}
+
+		// Another upload may take the name between the check and the link, so try again if it does
+		for attempt := 0; attempt < 5; attempt++ {
+			candidate, err := t.UniqueSlug(stem, exists, SlugOptions{MaxLength: maxFilenameLength - len(ext)})
+			if err != nil {
+				return "", 0, err
+			}
+
+			err = link(candidate + ext)
+			if os.IsExist(err) {
+				continue
+			}
+			return candidate + ext, 0, err
+		}
+		return "", 0, fmt.Errorf("%w: %s", ErrFileExists, name)
+
+	default:
+		var replaced int64
+		if info, err := os.Lstat(filepath.Join(dir, name)); err == nil && info.Mode().IsRegular() {
+			replaced = info.Size()
+		}
+		if err := os.Rename(staged, filepath.Join(dir, name)); err != nil {
+			return "", 0, err
+		}
+		return name, replaced, nil
+	}
+}
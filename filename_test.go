@@ -0,0 +1,129 @@
+package toolkit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var sanitizeFilenameTests = []struct {
+	name          string
+	filename      string
+	expected      string
+	errorExpected bool
+}{
+	{name: "plain", filename: "Holiday Photo.JPG", expected: "holiday-photo.jpg"},
+	{name: "path traversal", filename: "../../etc/passwd", expected: "passwd"},
+	{name: "windows path", filename: `..\..\Windows\win.ini`, expected: "win.ini"},
+	{name: "nul byte", filename: "evil\x00.png", expected: "evil.png"},
+	{name: "control characters", filename: "bad\r\nname\t.txt", expected: "bad-name.txt"},
+	{name: "reserved windows name", filename: "CON.txt", expected: "con-file.txt"},
+	{name: "reserved windows name without extension", filename: "lpt1", expected: "lpt1-file"},
+	{name: "accents", filename: "Résumé.pdf", expected: "resume.pdf"},
+	{name: "dot file", filename: ".env", expected: "env"},
+	{name: "nothing usable", filename: "東京.png", expected: "file.png"},
+	{name: "dots only", filename: "..", expected: "file"},
+	{name: "odd extension", filename: "archive.T@R", expected: "archive.tr"},
+	{name: "empty", filename: "", errorExpected: true},
+}
+
+func TestTools_SanitizeFilename(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range sanitizeFilenameTests {
+		got, err := testTools.SanitizeFilename(e.filename)
+
+		if e.errorExpected && err == nil {
+			t.Errorf("%s: error expected but got none", e.name)
+		}
+		if !e.errorExpected && err != nil {
+			t.Errorf("%s: error not expected but got one: %s", e.name, err)
+		}
+		if !e.errorExpected && got != e.expected {
+			t.Errorf("%s: expected %q, got %q", e.name, e.expected, got)
+		}
+	}
+
+	long, err := testTools.SanitizeFilename(strings.Repeat("word ", 100) + ".txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(long) > maxFilenameLength || !strings.HasSuffix(long, ".txt") {
+		t.Errorf("expected a name of at most %d bytes ending in .txt, got %d bytes: %s", maxFilenameLength, len(long), long)
+	}
+}
+
+var renamedExtensionTests = []struct {
+	name     string
+	filename string
+	expected string
+}{
+	{name: "plain", filename: "Logo.PNG", expected: ".png"},
+	{name: "backslashes", filename: `logo.png\..\..\evil`, expected: ""},
+	{name: "backslash in extension", filename: `logo.p\ng`, expected: ""},
+	{name: "odd characters", filename: "logo.P N;%G", expected: ".png"},
+	{name: "long extension", filename: "logo." + strings.Repeat("x", 300), expected: "." + strings.Repeat("x", maxExtensionLength)},
+	{name: "no extension", filename: "logo", expected: ""},
+}
+
+func TestTools_UploadFilesRenamedExtension(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range renamedExtensionTests {
+		request := newUploadRequest(t, nil, testUploadFile{field: "file", name: e.filename, contents: testPNG(t)})
+		files, err := testTools.UploadFiles(request, t.TempDir())
+		if err != nil {
+			t.Errorf("%s: %s", e.name, err)
+			continue
+		}
+		if filepath.Ext(files[0].NewFileName) != e.expected {
+			t.Errorf("%s: expected the extension %q, got %s", e.name, e.expected, files[0].NewFileName)
+		}
+	}
+}
+
+func TestTools_UploadFilesCollisionPolicy(t *testing.T) {
+	uploadDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(uploadDir, "logo.png"), []byte("existing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(policy CollisionPolicy) ([]*UploadedFile, error) {
+		request := newUploadRequest(t, nil, testUploadFile{field: "file", name: "Logo.png", contents: testPNG(t)})
+		testTools := Tools{UploadCollisionPolicy: policy}
+		return testTools.UploadFiles(request, uploadDir, false)
+	}
+
+	if _, err := upload(CollisionFail); !errors.Is(err, ErrFileExists) {
+		t.Errorf("fail policy: expected ErrFileExists, got %v", err)
+	}
+
+	for _, expected := range []string{"logo-2.png", "logo-3.png"} {
+		files, err := upload(CollisionSuffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if files[0].NewFileName != expected {
+			t.Errorf("suffix policy: expected %s, got %s", expected, files[0].NewFileName)
+		}
+	}
+
+	existing, _ := os.ReadFile(filepath.Join(uploadDir, "logo.png"))
+	if string(existing) != "existing" {
+		t.Error("the existing file should not have been changed")
+	}
+
+	files, err := upload(CollisionOverwrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files[0].NewFileName != "logo.png" {
+		t.Errorf("overwrite policy: expected logo.png, got %s", files[0].NewFileName)
+	}
+	overwritten, _ := os.ReadFile(filepath.Join(uploadDir, "logo.png"))
+	if string(overwritten) == "existing" {
+		t.Error("overwrite policy: the existing file should have been replaced")
+	}
+}
@@ -0,0 +1,352 @@
+package toolkit
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IDFormat selects the kind of identifier returned by NewID
+type IDFormat int
+
+const (
+	// IDRandomString is a 25 character string from RandomString
+	IDRandomString IDFormat = iota
+	// IDUUIDv4 is a random UUID
+	IDUUIDv4
+	// IDUUIDv7 is a time-ordered UUID
+	IDUUIDv7
+	// IDULID is a monotonic ULID
+	IDULID
+	// IDKSUID is a K-Sortable Unique IDentifier
+	IDKSUID
+	// IDNanoID is a 21 character NanoID
+	IDNanoID
+)
+
+// NewID returns a new identifier of the given format as a string. UploadFiles uses it,
+// with t.RenameFormat, to name renamed files.
+func (t *Tools) NewID(format IDFormat) (string, error) {
+	switch format {
+	case IDRandomString:
+		return t.GenerateRandomString(25)
+	case IDUUIDv4:
+		id, err := t.NewUUIDv4()
+		return id.String(), err
+	case IDUUIDv7:
+		id, err := t.NewUUIDv7()
+		return id.String(), err
+	case IDULID:
+		id, err := t.NewULID()
+		return id.String(), err
+	case IDKSUID:
+		id, err := t.NewKSUID()
+		return id.String(), err
+	case IDNanoID:
+		return t.NewNanoID(nanoIDSize)
+	default:
+		return "", fmt.Errorf("unknown ID format %d", format)
+	}
+}
+
+// UUID is a RFC 9562 universally unique identifier
+type UUID [16]byte
+
+// NewUUIDv4 returns a random (version 4) UUID
+func (t *Tools) NewUUIDv4() (UUID, error) {
+	var u UUID
+	if _, err := rand.Read(u[:]); err != nil {
+		return UUID{}, fmt.Errorf("reading random bytes: %w", err)
+	}
+	u.setVersion(4)
+	return u, nil
+}
+
+// NewUUIDv7 returns a time-ordered (version 7) UUID. The first 48 bits are the
+// Unix time in milliseconds, so they sort by creation time.
+func (t *Tools) NewUUIDv7() (UUID, error) {
+	var u UUID
+	if _, err := rand.Read(u[6:]); err != nil {
+		return UUID{}, fmt.Errorf("reading random bytes: %w", err)
+	}
+	ms := uint64(time.Now().UnixMilli())
+	u[0], u[1], u[2] = byte(ms>>40), byte(ms>>32), byte(ms>>24)
+	u[3], u[4], u[5] = byte(ms>>16), byte(ms>>8), byte(ms)
+	u.setVersion(7)
+	return u, nil
+}
+
+// setVersion sets the version nibble and the RFC 9562 variant bits
+func (u *UUID) setVersion(v byte) {
+	u[6] = u[6]&0x0f | v<<4
+	u[8] = u[8]&0x3f | 0x80
+}
+
+// ParseUUID parses a UUID in its canonical xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx form
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return UUID{}, fmt.Errorf("invalid UUID %q", s)
+	}
+	if _, err := hex.Decode(u[:], []byte(s[0:8]+s[9:13]+s[14:18]+s[19:23]+s[24:])); err != nil {
+		return UUID{}, fmt.Errorf("invalid UUID %q", s)
+	}
+	if u[8]&0xc0 != 0x80 {
+		return UUID{}, fmt.Errorf("invalid UUID variant in %q", s)
+	}
+	return u, nil
+}
+
+// String returns the canonical lower case form of the UUID
+func (u UUID) String() string {
+	var b [36]byte
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return string(b[:])
+}
+
+// Version returns the version of the UUID
+func (u UUID) Version() int {
+	return int(u[6] >> 4)
+}
+
+// Time returns the creation time of a version 7 UUID, or the zero time for other versions
+func (u UUID) Time() time.Time {
+	if u.Version() != 7 {
+		return time.Time{}
+	}
+	ms := int64(u[0])<<40 | int64(u[1])<<32 | int64(u[2])<<24 | int64(u[3])<<16 | int64(u[4])<<8 | int64(u[5])
+	return time.UnixMilli(ms)
+}
+
+// ULID is a Universally Unique Lexicographically Sortable Identifier: a 48 bit
+// millisecond timestamp followed by 80 random bits
+type ULID [16]byte
+
+// ULIDGenerator creates ULIDs. In monotonic mode, ULIDs created within the same
+// millisecond increment the random part of the previous one, so they still sort
+// in creation order. It is safe for concurrent use.
+type ULIDGenerator struct {
+	Monotonic bool
+
+	mu   sync.Mutex
+	last ULID
+}
+
+// defaultULIDs is the generator used by Tools.NewULID
+var defaultULIDs = &ULIDGenerator{Monotonic: true}
+
+// NewULID returns a new monotonic ULID
+func (t *Tools) NewULID() (ULID, error) {
+	return defaultULIDs.New()
+}
+
+// New returns a ULID for the current time
+func (g *ULIDGenerator) New() (ULID, error) {
+	return g.NewAt(time.Now())
+}
+
+// NewAt returns a ULID for the given time
+func (g *ULIDGenerator) NewAt(now time.Time) (ULID, error) {
+	ms := uint64(now.UnixMilli())
+	if ms >= 1<<48 {
+		return ULID{}, errors.New("time is too far in the future for a ULID")
+	}
+
+	var u ULID
+	u[0], u[1], u[2] = byte(ms>>40), byte(ms>>32), byte(ms>>24)
+	u[3], u[4], u[5] = byte(ms>>16), byte(ms>>8), byte(ms)
+
+	if !g.Monotonic {
+		if _, err := rand.Read(u[6:]); err != nil {
+			return ULID{}, fmt.Errorf("reading random bytes: %w", err)
+		}
+		return u, nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.last.timestamp() >= ms {
+		// Same millisecond (or the clock went back): increment the previous random part
+		u = g.last
+		for i := 15; i >= 6; i-- {
+			u[i]++
+			if u[i] != 0 {
+				break
+			}
+			if i == 6 {
+				return ULID{}, errors.New("ULID random part overflowed within one millisecond")
+			}
+		}
+	} else if _, err := rand.Read(u[6:]); err != nil {
+		return ULID{}, fmt.Errorf("reading random bytes: %w", err)
+	}
+
+	g.last = u
+	return u, nil
+}
+
+// ParseULID parses the 26 character Crockford base32 form of a ULID. Lower case is accepted.
+func ParseULID(s string) (ULID, error) {
+	if len(s) != 26 {
+		return ULID{}, fmt.Errorf("invalid ULID %q: must be 26 characters", s)
+	}
+	if s[0] > '7' {
+		return ULID{}, fmt.Errorf("invalid ULID %q: value overflows 128 bits", s)
+	}
+
+	var hi, lo uint64
+	for i := 0; i < len(s); i++ {
+		v := strings.IndexByte(AlphabetCrockford, upperASCII(s[i]))
+		if v < 0 {
+			return ULID{}, fmt.Errorf("invalid ULID %q: unexpected character %q", s, s[i])
+		}
+		hi = hi<<5 | lo>>59
+		lo = lo<<5 | uint64(v)
+	}
+
+	var u ULID
+	binary.BigEndian.PutUint64(u[:8], hi)
+	binary.BigEndian.PutUint64(u[8:], lo)
+	return u, nil
+}
+
+// String returns the 26 character Crockford base32 form of the ULID
+func (u ULID) String() string {
+	hi, lo := binary.BigEndian.Uint64(u[:8]), binary.BigEndian.Uint64(u[8:])
+	var b [26]byte
+	for i := 25; i >= 0; i-- {
+		b[i] = AlphabetCrockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(b[:])
+}
+
+// Time returns the creation time of the ULID
+func (u ULID) Time() time.Time {
+	return time.UnixMilli(int64(u.timestamp()))
+}
+
+// timestamp returns the millisecond timestamp of the ULID
+func (u ULID) timestamp() uint64 {
+	return uint64(u[0])<<40 | uint64(u[1])<<32 | uint64(u[2])<<24 | uint64(u[3])<<16 | uint64(u[4])<<8 | uint64(u[5])
+}
+
+// upperASCII upper cases an ASCII letter
+func upperASCII(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+const (
+	// ksuidEpoch is the start of KSUID time, 2014-05-13T16:53:20Z
+	ksuidEpoch = 1400000000
+	// base62Alphabet is the alphabet used to encode KSUIDs and API key checksums
+	base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	// ksuidLength is the length of an encoded KSUID
+	ksuidLength = 27
+)
+
+// KSUID is a K-Sortable Unique IDentifier: a 32 bit timestamp in seconds followed by 128 random bits
+type KSUID [20]byte
+
+// NewKSUID returns a new KSUID
+func (t *Tools) NewKSUID() (KSUID, error) {
+	var k KSUID
+	if _, err := rand.Read(k[4:]); err != nil {
+		return KSUID{}, fmt.Errorf("reading random bytes: %w", err)
+	}
+	binary.BigEndian.PutUint32(k[:4], uint32(time.Now().Unix()-ksuidEpoch))
+	return k, nil
+}
+
+// ParseKSUID parses the 27 character base62 form of a KSUID
+func ParseKSUID(s string) (KSUID, error) {
+	if len(s) != ksuidLength {
+		return KSUID{}, fmt.Errorf("invalid KSUID %q: must be %d characters", s, ksuidLength)
+	}
+
+	n, base := new(big.Int), big.NewInt(62)
+	for i := 0; i < len(s); i++ {
+		v := strings.IndexByte(base62Alphabet, s[i])
+		if v < 0 {
+			return KSUID{}, fmt.Errorf("invalid KSUID %q: unexpected character %q", s, s[i])
+		}
+		n.Mul(n, base).Add(n, big.NewInt(int64(v)))
+	}
+	if n.BitLen() > 160 {
+		return KSUID{}, fmt.Errorf("invalid KSUID %q: value overflows 160 bits", s)
+	}
+
+	var k KSUID
+	n.FillBytes(k[:])
+	return k, nil
+}
+
+// String returns the 27 character base62 form of the KSUID
+func (k KSUID) String() string {
+	n, base, rem := new(big.Int).SetBytes(k[:]), big.NewInt(62), new(big.Int)
+	b := []byte(strings.Repeat("0", ksuidLength))
+	for i := ksuidLength - 1; i >= 0 && n.Sign() > 0; i-- {
+		n.DivMod(n, base, rem)
+		b[i] = base62Alphabet[rem.Int64()]
+	}
+	return string(b)
+}
+
+// Time returns the creation time of the KSUID
+func (k KSUID) Time() time.Time {
+	return time.Unix(int64(binary.BigEndian.Uint32(k[:4]))+ksuidEpoch, 0)
+}
+
+// nanoIDSize is the default length of a NanoID
+const nanoIDSize = 21
+
+// NewNanoID returns a NanoID of the given size. The default alphabet is AlphabetURLSafe.
+func (t *Tools) NewNanoID(size int, alphabet ...string) (string, error) {
+	source := AlphabetURLSafe
+	if len(alphabet) > 0 {
+		source = alphabet[0]
+	}
+	if size <= 0 {
+		return "", errors.New("NanoID size must be positive")
+	}
+	return t.GenerateRandomString(size, source)
+}
+
+// ValidateNanoID checks that id has the given size and only uses characters from the
+// alphabet. The default alphabet is AlphabetURLSafe.
+func ValidateNanoID(id string, size int, alphabet ...string) error {
+	source := AlphabetURLSafe
+	if len(alphabet) > 0 {
+		source = alphabet[0]
+	}
+
+	r := []rune(id)
+	if len(r) != size {
+		return fmt.Errorf("invalid NanoID %q: must be %d characters", id, size)
+	}
+	for _, c := range r {
+		if !strings.ContainsRune(source, c) {
+			return fmt.Errorf("invalid NanoID %q: unexpected character %q", id, c)
+		}
+	}
+	return nil
+}
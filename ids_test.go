@@ -0,0 +1,208 @@
+package toolkit
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTools_NewUUIDv4(t *testing.T) {
+	var testTools Tools
+
+	u, err := testTools.NewUUIDv4()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Version() != 4 {
+		t.Errorf("expected version 4, got %d", u.Version())
+	}
+
+	parsed, err := ParseUUID(u.String())
+	if err != nil {
+		t.Errorf("failed to parse %s: %s", u, err)
+	}
+	if parsed != u {
+		t.Errorf("expected %s, got %s", u, parsed)
+	}
+}
+
+func TestTools_NewUUIDv7(t *testing.T) {
+	var testTools Tools
+
+	before := time.Now().Truncate(time.Millisecond)
+	u, err := testTools.NewUUIDv7()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Version() != 7 {
+		t.Errorf("expected version 7, got %d", u.Version())
+	}
+	if u.Time().Before(before) || u.Time().After(time.Now()) {
+		t.Errorf("unexpected time %s", u.Time())
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(u.String()) {
+		t.Errorf("unexpected format %s", u)
+	}
+}
+
+var parseUUIDTests = []struct {
+	name          string
+	s             string
+	errorExpected bool
+}{
+	{name: "valid", s: "f81d4fae-7dec-41d0-a765-00a0c91e6bf6", errorExpected: false},
+	{name: "upper case", s: "F81D4FAE-7DEC-41D0-A765-00A0C91E6BF6", errorExpected: false},
+	{name: "too short", s: "f81d4fae-7dec-41d0-a765-00a0c91e6bf", errorExpected: true},
+	{name: "missing dashes", s: "f81d4fae7dec41d0a76500a0c91e6bf6", errorExpected: true},
+	{name: "not hex", s: "g81d4fae-7dec-41d0-a765-00a0c91e6bf6", errorExpected: true},
+	{name: "wrong variant", s: "f81d4fae-7dec-41d0-c765-00a0c91e6bf6", errorExpected: true},
+}
+
+func TestParseUUID(t *testing.T) {
+	for _, e := range parseUUIDTests {
+		_, err := ParseUUID(e.s)
+		if e.errorExpected && err == nil {
+			t.Errorf("%s: error expected but got none", e.name)
+		}
+		if !e.errorExpected && err != nil {
+			t.Errorf("%s: error not expected but got one: %s", e.name, err)
+		}
+	}
+}
+
+func TestULIDGenerator_Monotonic(t *testing.T) {
+	g := &ULIDGenerator{Monotonic: true}
+	now := time.Now()
+
+	var previous string
+	for i := 0; i < 1000; i++ {
+		u, err := g.NewAt(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := u.String()
+		if s <= previous {
+			t.Fatalf("ULIDs are not increasing: %s after %s", s, previous)
+		}
+		previous = s
+	}
+}
+
+func TestParseULID(t *testing.T) {
+	var testTools Tools
+
+	u, err := testTools.NewULID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseULID(strings.ToLower(u.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed != u {
+		t.Errorf("expected %s, got %s", u, parsed)
+	}
+	if time.Since(parsed.Time()) > time.Minute {
+		t.Errorf("unexpected time %s", parsed.Time())
+	}
+
+	for _, s := range []string{"", "01ARZ3NDEKTSV4RRFFQ69G5FA", "81ARZ3NDEKTSV4RRFFQ69G5FAV", "01ARZ3NDEKTSV4RRFFQ69G5FAU"} {
+		if _, err := ParseULID(s); err == nil {
+			t.Errorf("expected an error parsing %q", s)
+		}
+	}
+}
+
+func TestParseKSUID(t *testing.T) {
+	var testTools Tools
+
+	k, err := testTools.NewKSUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(k.String()) != 27 {
+		t.Errorf("expected 27 characters, got %d", len(k.String()))
+	}
+
+	parsed, err := ParseKSUID(k.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed != k {
+		t.Errorf("expected %s, got %s", k, parsed)
+	}
+	if time.Since(parsed.Time()) > time.Minute {
+		t.Errorf("unexpected time %s", parsed.Time())
+	}
+
+	// the largest KSUID, and one past it
+	if _, err := ParseKSUID("aWgEPTl1tmebfsQzFP4bxwgy80V"); err != nil {
+		t.Errorf("failed to parse the largest KSUID: %s", err)
+	}
+	if _, err := ParseKSUID("aWgEPTl1tmebfsQzFP4bxwgy80W"); err == nil {
+		t.Error("expected an overflow error")
+	}
+}
+
+func TestTools_NewNanoID(t *testing.T) {
+	var testTools Tools
+
+	id, err := testTools.NewNanoID(21)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateNanoID(id, 21); err != nil {
+		t.Error(err)
+	}
+
+	id, err = testTools.NewNanoID(8, AlphabetHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateNanoID(id, 8, AlphabetHex); err != nil {
+		t.Error(err)
+	}
+	if err := ValidateNanoID("xyz", 3, AlphabetHex); err == nil {
+		t.Error("expected an error for characters outside the alphabet")
+	}
+
+	if _, err := testTools.NewNanoID(0); err == nil {
+		t.Error("expected an error for size 0")
+	}
+}
+
+func TestTools_UploadFilesRenameFormat(t *testing.T) {
+	validators := map[IDFormat]func(string) error{
+		IDUUIDv4: func(s string) error { _, err := ParseUUID(s); return err },
+		IDUUIDv7: func(s string) error { _, err := ParseUUID(s); return err },
+		IDULID:   func(s string) error { _, err := ParseULID(s); return err },
+		IDKSUID:  func(s string) error { _, err := ParseKSUID(s); return err },
+		IDNanoID: func(s string) error { return ValidateNanoID(s, 21) },
+	}
+
+	for format, validate := range validators {
+		request := newUploadRequest(t, nil, testUploadFile{field: "file", name: "logo.png", contents: testPNG(t)})
+
+		var testTools Tools
+		testTools.RenameFormat = format
+		uploadedFiles, err := testTools.UploadFiles(request, "./testdata/uploads/")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		name := uploadedFiles[0].NewFileName
+		_ = os.Remove(filepath.Join("./testdata/uploads", name))
+
+		if filepath.Ext(name) != ".png" {
+			t.Errorf("format %d: expected the .png extension to be kept, got %s", format, name)
+		}
+		if err := validate(strings.TrimSuffix(name, ".png")); err != nil {
+			t.Errorf("format %d: %s", format, err)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Reasons given in JanitorDeletion
+const (
+	// JanitorExpired files are older than JanitorConfig.TTL
+	JanitorExpired = "expired"
+	// JanitorQuota files were evicted, oldest first, to get under MaxBytes or MaxFiles
+	JanitorQuota = "quota"
+	// JanitorAbandoned files match a temporary file pattern and are older than TempTTL
+	JanitorAbandoned = "abandoned"
+)
+
+// defaultTempPatterns match the temporary files the toolkit itself leaves in a directory,
+// so uploaded files are never taken for them
+var defaultTempPatterns = []string{".write-check-*", stagedUploadPrefix + "*" + stagedUploadSuffix}
+
+// JanitorConfig configures CleanUploads and StartJanitor. Only the top level of Dir is
+// looked at; directories are left alone unless they match a temporary pattern.
+type JanitorConfig struct {
+	// Dir is the upload directory to clean
+	Dir string
+	// Interval between sweeps of a started janitor. Defaults to 1 hour
+	Interval time.Duration
+	// TTL is the age after which files are deleted. Zero keeps files forever
+	TTL time.Duration
+	// MaxBytes is the total size the directory may use. Zero means no limit
+	MaxBytes int64
+	// MaxFiles is the number of files the directory may hold. Zero means no limit
+	MaxFiles int
+	// TempPatterns match abandoned temporary and partial files, with filepath.Match.
+	// Defaults to .write-check-* and .upload-*.part, where UploadFiles writes files until
+	// they are complete; add the patterns given to MkdirTemp or used for other partial files
+	TempPatterns []string
+	// TempTTL is the age after which temporary files are considered abandoned. Defaults to 1 hour
+	TempTTL time.Duration
+	// QuotaKey returns the quota key of a deleted file, whose size is freed from
+	// Tools.QuotaStore if it is set. Defaults to Dir, the key UploadFiles uses when
+	// Tools.QuotaKey isn't set. Abandoned files never counted against a quota.
+	QuotaKey func(path string) string
+	// DryRun reports what would be deleted without deleting anything
+	DryRun bool
+	// OnDelete is called for every file that is, or in a dry run would be, deleted
+	OnDelete func(JanitorDeletion)
+	// OnError is called when a background sweep fails
+	OnError func(error)
+}
+
+// JanitorDeletion describes one file removed by the janitor
+type JanitorDeletion struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Reason  string
+	DryRun  bool
+	// Err is set if the file could not be removed
+	Err error
+}
+
+// JanitorReport is the result of one sweep
+type JanitorReport struct {
+	Deletions      []JanitorDeletion
+	FreedBytes     int64
+	RemainingBytes int64
+	RemainingFiles int
+}
+
+// CleanUploads sweeps cfg.Dir once: it removes abandoned temporary files, files older
+// than the TTL, and then the oldest files until the directory is within its quota. The
+// size of deleted uploads is freed from t.QuotaStore, if it is set.
+func (t *Tools) CleanUploads(cfg JanitorConfig) (JanitorReport, error) {
+	var report JanitorReport
+
+	if cfg.Dir == "" {
+		return report, errors.New("janitor directory must not be empty")
+	}
+
+	patterns := cfg.TempPatterns
+	if patterns == nil {
+		patterns = defaultTempPatterns
+	}
+	tempTTL := cfg.TempTTL
+	if tempTTL == 0 {
+		tempTTL = time.Hour
+	}
+
+	entries, err := os.ReadDir(cfg.Dir)
+	if err != nil {
+		return report, err
+	}
+
+	// Deleted uploads no longer count against the quota
+	var freeErrs []error
+	remove := func(d JanitorDeletion) bool {
+		if !report.delete(cfg, d) {
+			return false
+		}
+		if t.QuotaStore != nil && !cfg.DryRun && d.Reason != JanitorAbandoned {
+			key := filepath.Clean(cfg.Dir)
+			if cfg.QuotaKey != nil {
+				key = cfg.QuotaKey(d.Path)
+			}
+			if err := t.QuotaStore.Free(key, d.Size); err != nil {
+				freeErrs = append(freeErrs, fmt.Errorf("freeing quota of %s: %w", d.Path, err))
+			}
+		}
+		return true
+	}
+
+	now := time.Now()
+	var kept []JanitorDeletion
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// Removed since ReadDir
+			continue
+		}
+
+		file := JanitorDeletion{
+			Path:    filepath.Join(cfg.Dir, entry.Name()),
+			ModTime: info.ModTime(),
+			DryRun:  cfg.DryRun,
+		}
+		if info.Mode().IsRegular() {
+			file.Size = info.Size()
+		}
+		age := now.Sub(info.ModTime())
+
+		if matchesAny(entry.Name(), patterns) {
+			// In-progress temporary files are neither expired nor counted in the quota
+			if age > tempTTL {
+				file.Reason = JanitorAbandoned
+				remove(file)
+			}
+			continue
+		}
+
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		if cfg.TTL > 0 && age > cfg.TTL {
+			file.Reason = JanitorExpired
+			remove(file)
+			continue
+		}
+		kept = append(kept, file)
+	}
+
+	// Evict the oldest files first until the directory fits in its quota
+	sort.Slice(kept, func(i, j int) bool { return kept[i].ModTime.Before(kept[j].ModTime) })
+
+	var total int64
+	for _, f := range kept {
+		total += f.Size
+	}
+	count := len(kept)
+
+	for _, f := range kept {
+		if (cfg.MaxFiles <= 0 || count <= cfg.MaxFiles) && (cfg.MaxBytes <= 0 || total <= cfg.MaxBytes) {
+			break
+		}
+		f.Reason = JanitorQuota
+		if remove(f) {
+			total -= f.Size
+			count--
+		}
+	}
+
+	report.RemainingBytes = total
+	report.RemainingFiles = count
+	return report, errors.Join(freeErrs...)
+}
+
+// delete removes a file, unless this is a dry run, and records it in the report.
+// It reports whether the file is gone, or would be in a dry run.
+func (r *JanitorReport) delete(cfg JanitorConfig, d JanitorDeletion) bool {
+	if !cfg.DryRun {
+		d.Err = os.RemoveAll(d.Path)
+	}
+	if d.Err == nil {
+		r.FreedBytes += d.Size
+	}
+
+	r.Deletions = append(r.Deletions, d)
+	if cfg.OnDelete != nil {
+		cfg.OnDelete(d)
+	}
+	return d.Err == nil
+}
+
+// matchesAny reports whether name matches one of the filepath.Match patterns
+func matchesAny(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Janitor cleans an upload directory in the background. Create one with StartJanitor.
+type Janitor struct {
+	tools *Tools
+	cfg   JanitorConfig
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+
+	mu   sync.Mutex
+	last JanitorReport
+}
+
+// StartJanitor sweeps cfg.Dir with CleanUploads right away, and then every cfg.Interval
+// until ctx is done or Stop is called.
+func (t *Tools) StartJanitor(ctx context.Context, cfg JanitorConfig) (*Janitor, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("janitor directory must not be empty")
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+
+	j := &Janitor{
+		tools: t,
+		cfg:   cfg,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	go j.run(ctx)
+	return j, nil
+}
+
+// run sweeps on every tick until stopped
+func (j *Janitor) run(ctx context.Context) {
+	defer close(j.done)
+
+	ticker := time.NewTicker(j.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		j.sweep()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-j.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep runs one pass and keeps its report
+func (j *Janitor) sweep() {
+	report, err := j.tools.CleanUploads(j.cfg)
+	if err != nil && j.cfg.OnError != nil {
+		j.cfg.OnError(err)
+	}
+
+	j.mu.Lock()
+	j.last = report
+	j.mu.Unlock()
+}
+
+// LastReport returns the report of the most recent sweep
+func (j *Janitor) LastReport() JanitorReport {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.last
+}
+
+// Stop stops the janitor and waits for a sweep in progress to finish
+func (j *Janitor) Stop() {
+	j.stopOnce.Do(func() { close(j.stop) })
+	<-j.done
+}
@@ -0,0 +1,202 @@
+package toolkit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// writeAgedFile creates a file of the given size with a modification time age ago
+func writeAgedFile(t *testing.T, dir, name string, size int, age time.Duration) {
+	t.Helper()
+
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-age)
+	if err := os.Chtimes(p, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// deletedNames returns the base names of the deleted files, sorted
+func deletedNames(report JanitorReport) []string {
+	var names []string
+	for _, d := range report.Deletions {
+		names = append(names, filepath.Base(d.Path)+":"+d.Reason)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestTools_CleanUploads(t *testing.T) {
+	var testTools Tools
+	dir := t.TempDir()
+
+	writeAgedFile(t, dir, "expired.png", 10, 48*time.Hour)
+	writeAgedFile(t, dir, "old.png", 100, 3*time.Hour)
+	writeAgedFile(t, dir, "middle.png", 100, 2*time.Hour)
+	writeAgedFile(t, dir, "new.png", 100, time.Minute)
+	writeAgedFile(t, dir, "abandoned.part", 50, 2*time.Hour)
+	writeAgedFile(t, dir, "in-progress.part", 50, time.Minute)
+
+	cfg := JanitorConfig{Dir: dir, TTL: 24 * time.Hour, MaxBytes: 150, TempPatterns: []string{"*.part"}, DryRun: true}
+
+	var callbacks int
+	cfg.OnDelete = func(JanitorDeletion) { callbacks++ }
+
+	// a dry run reports without deleting
+	report, err := testTools.CleanUploads(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"abandoned.part:abandoned", "expired.png:expired", "middle.png:quota", "old.png:quota"}
+	got := deletedNames(report)
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, got)
+			break
+		}
+	}
+	if callbacks != len(expected) {
+		t.Errorf("expected %d callbacks, got %d", len(expected), callbacks)
+	}
+	if report.FreedBytes != 260 || report.RemainingBytes != 100 || report.RemainingFiles != 1 {
+		t.Errorf("unexpected totals: %+v", report)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 6 {
+		t.Errorf("dry run deleted files, %d left", len(entries))
+	}
+
+	// a real run deletes the same files
+	cfg.DryRun = false
+	if _, err := testTools.CleanUploads(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ = os.ReadDir(dir)
+	var left []string
+	for _, e := range entries {
+		left = append(left, e.Name())
+	}
+	sort.Strings(left)
+	if len(left) != 2 || left[0] != "in-progress.part" || left[1] != "new.png" {
+		t.Errorf("unexpected files left: %v", left)
+	}
+}
+
+func TestTools_CleanUploadsDefaultPatterns(t *testing.T) {
+	var testTools Tools
+	dir := t.TempDir()
+
+	writeAgedFile(t, dir, ".write-check-123", 0, 2*time.Hour)
+	writeAgedFile(t, dir, ".upload-abc.part", 10, 2*time.Hour)
+	writeAgedFile(t, dir, "chapter.part", 10, 2*time.Hour)
+	writeAgedFile(t, dir, "upload-report.pdf", 10, 2*time.Hour)
+	writeAgedFile(t, dir, "notes.tmp", 10, 2*time.Hour)
+	if err := os.Mkdir(filepath.Join(dir, "upload-2024"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// only files the toolkit wrote are temporary, and uploads are kept without a TTL
+	report, err := testTools.CleanUploads(JanitorConfig{Dir: dir, TempTTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := deletedNames(report); len(got) != 2 || got[0] != ".upload-abc.part:abandoned" || got[1] != ".write-check-123:abandoned" {
+		t.Errorf("expected only the staged upload and the write check to be removed, got %v", got)
+	}
+}
+
+func TestTools_CleanUploadsFailedUpload(t *testing.T) {
+	dir := t.TempDir()
+	testTools := Tools{UploadCollisionPolicy: CollisionFail}
+	writeAgedFile(t, dir, "logo.png", 10, time.Minute)
+
+	// a failed upload only leaves the existing file
+	request := newUploadRequest(t, nil, testUploadFile{field: "file", name: "logo.png", contents: testPNG(t)})
+	if _, err := testTools.UploadFiles(request, dir, false); err == nil {
+		t.Fatal("expected the upload to fail")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected the staged file to be removed, got %d files", len(entries))
+	}
+
+	// the staged file of a request that never finished is abandoned
+	staged, err := testTools.createStagedUpload(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = staged.Close()
+	mtime := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(staged.Name(), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := testTools.CleanUploads(JanitorConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Deletions) != 1 || report.Deletions[0].Path != staged.Name() || report.Deletions[0].Reason != JanitorAbandoned {
+		t.Errorf("expected the staged file to be removed, got %v", deletedNames(report))
+	}
+}
+
+func TestTools_CleanUploadsMaxFiles(t *testing.T) {
+	var testTools Tools
+	dir := t.TempDir()
+
+	writeAgedFile(t, dir, "a.png", 1, 3*time.Minute)
+	writeAgedFile(t, dir, "b.png", 1, 2*time.Minute)
+	writeAgedFile(t, dir, "c.png", 1, time.Minute)
+
+	report, err := testTools.CleanUploads(JanitorConfig{Dir: dir, MaxFiles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Deletions) != 1 || filepath.Base(report.Deletions[0].Path) != "a.png" {
+		t.Errorf("expected the oldest file to be evicted, got %v", deletedNames(report))
+	}
+}
+
+func TestTools_StartJanitor(t *testing.T) {
+	var testTools Tools
+	dir := t.TempDir()
+	writeAgedFile(t, dir, "expired.png", 1, 2*time.Hour)
+
+	deleted := make(chan JanitorDeletion, 1)
+	janitor, err := testTools.StartJanitor(context.Background(), JanitorConfig{
+		Dir:      dir,
+		TTL:      time.Hour,
+		Interval: 10 * time.Millisecond,
+		OnDelete: func(d JanitorDeletion) { deleted <- d },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer janitor.Stop()
+
+	select {
+	case d := <-deleted:
+		if d.Reason != JanitorExpired {
+			t.Errorf("expected reason %s, got %s", JanitorExpired, d.Reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("janitor did not delete the expired file")
+	}
+
+	janitor.Stop()
+	if _, err := os.Stat(filepath.Join(dir, "expired.png")); !os.IsNotExist(err) {
+		t.Error("expected the expired file to be removed")
+	}
+}
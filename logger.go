@@ -0,0 +1,61 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/charmbracelet/log"
+)
+
+// NewCharmLogHandler returns a slog.Handler that writes human-readable, optionally
+// coloured lines to w with charmbracelet/log, the way the toolkit used to log:
+//
+//	tools := toolkit.Tools{Logger: slog.New(toolkit.NewCharmLogHandler(os.Stderr))}
+func NewCharmLogHandler(w io.Writer, opts ...log.Options) slog.Handler {
+	options := log.Options{ReportTimestamp: true}
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	return log.NewWithOptions(w, options)
+}
+
+// NewJSONLogHandler returns a slog.Handler that writes one JSON object per event to w,
+// skipping events below level, for log collectors
+func NewJSONLogHandler(w io.Writer, level slog.Leveler) slog.Handler {
+	return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
+}
+
+// logger returns t.Logger, or slog.Default if it isn't set. Use
+// slog.New(slog.DiscardHandler) to silence the toolkit.
+func (t *Tools) logger() *slog.Logger {
+	if t.Logger != nil {
+		return t.Logger
+	}
+	return slog.Default()
+}
+
+// contextLogger returns the logger with the request ID found in ctx, if there is one
+func (t *Tools) contextLogger(ctx context.Context) *slog.Logger {
+	if id := RequestIDFromContext(ctx); id != "" {
+		return t.logger().With("request_id", id)
+	}
+	return t.logger()
+}
+
+// requestLogger returns the logger with the method, path and request ID of r
+func (t *Tools) requestLogger(r *http.Request) *slog.Logger {
+	return t.contextLogger(r.Context()).With("method", r.Method, "path", r.URL.Path)
+}
+
+// clientErrorStatus returns the status code of an error caused by the client, one with a
+// StatusCode method returning less than 500, or 0 for other errors
+func clientErrorStatus(err error) int {
+	var coder statusCoder
+	if errors.As(err, &coder) && coder.StatusCode() < http.StatusInternalServerError {
+		return coder.StatusCode()
+	}
+	return 0
+}
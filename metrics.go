@@ -0,0 +1,405 @@
+package toolkit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the histogram buckets used when none are given, suited to request
+// latencies in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// MetricsRegistry holds counters and histograms and serves them in the Prometheus text
+// exposition format. Set it as Tools.Metrics to record the toolkit's own metrics in it,
+// and register your own with Counter and Histogram:
+//
+//	registry := toolkit.NewMetricsRegistry()
+//	tools := toolkit.Tools{Metrics: registry}
+//	orders := registry.Counter("shop_orders_total", "Orders placed", "country")
+//	orders.Inc("es")
+//	mux.Handle("GET /metrics", registry)
+type MetricsRegistry struct {
+	mu      sync.Mutex
+	metrics map[string]metricFamily
+
+	toolkitOnce sync.Once
+	toolkit     *registryObserver
+}
+
+// metricFamily is a counter or a histogram with all its series
+type metricFamily interface {
+	describe() (kind, help string, labels []string)
+	write(w *bufio.Writer, name string)
+}
+
+// NewMetricsRegistry returns an empty registry
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{metrics: make(map[string]metricFamily)}
+}
+
+// Counter returns the counter with the given name, registering it the first time. A
+// counter with more than one series is split by the given label names. It panics if the
+// name is taken by a metric of another kind or with other labels, or isn't a valid name.
+func (reg *MetricsRegistry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{labels: slices.Clone(labels), series: make(map[string]*counterSeries)}
+	return reg.register(name, help, "counter", labels, c).(*Counter)
+}
+
+// Histogram returns the histogram with the given name, registering it the first time,
+// like Counter. Values are counted in buckets with the given upper bounds, DefaultBuckets
+// if there are none. Repeated bounds are counted once, and the +Inf bucket is always added.
+func (reg *MetricsRegistry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	buckets = slices.Compact(buckets)
+	buckets = slices.DeleteFunc(buckets, func(b float64) bool { return math.IsInf(b, 1) })
+	h := &Histogram{buckets: buckets, labels: slices.Clone(labels), series: make(map[string]*histogramSeries)}
+	return reg.register(name, help, "histogram", labels, h).(*Histogram)
+}
+
+// register adds a metric, or returns the one already registered with its name
+func (reg *MetricsRegistry) register(name, help, kind string, labels []string, m metricFamily) metricFamily {
+	if !validMetricName(name) {
+		panic(fmt.Sprintf("toolkit: invalid metric name %q", name))
+	}
+	for _, label := range labels {
+		if !validMetricName(label) || strings.Contains(label, ":") || label == "le" {
+			panic(fmt.Sprintf("toolkit: invalid label name %q for metric %s", label, name))
+		}
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if existing, ok := reg.metrics[name]; ok {
+		existingKind, _, existingLabels := existing.describe()
+		if existingKind != kind || !slices.Equal(existingLabels, labels) {
+			panic(fmt.Sprintf("toolkit: metric %s is already registered as a %s with labels %v", name, existingKind, existingLabels))
+		}
+		return existing
+	}
+
+	switch m := m.(type) {
+	case *Counter:
+		m.help = help
+	case *Histogram:
+		m.help = help
+	}
+	reg.metrics[name] = m
+	return m
+}
+
+// ServeHTTP writes every metric in the Prometheus text exposition format
+func (reg *MetricsRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	reg.mu.Lock()
+	names := slices.Sorted(maps.Keys(reg.metrics))
+	families := make([]metricFamily, len(names))
+	for i, name := range names {
+		families[i] = reg.metrics[name]
+	}
+	reg.mu.Unlock()
+
+	out := bufio.NewWriter(w)
+	for i, name := range names {
+		kind, help, _ := families[i].describe()
+		if help != "" {
+			fmt.Fprintf(out, "# HELP %s %s\n", name, escapeMetricHelp(help))
+		}
+		fmt.Fprintf(out, "# TYPE %s %s\n", name, kind)
+		families[i].write(out, name)
+	}
+	_ = out.Flush()
+}
+
+// Counter is a value that only goes up, such as a number of requests
+type Counter struct {
+	mu     sync.Mutex
+	help   string
+	labels []string
+	series map[string]*counterSeries
+}
+
+// counterSeries is the value of a counter for one set of label values
+type counterSeries struct {
+	labels []string
+	value  float64
+}
+
+// Inc adds 1 to the series with the given label values, in the order of the label names
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v to the series with the given label values. It panics if v is negative or
+// the number of label values doesn't match the label names.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("toolkit: counters can't decrease")
+	}
+	checkLabelValues(c.labels, labelValues)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := seriesKey(labelValues)
+	s, ok := c.series[key]
+	if !ok {
+		s = &counterSeries{labels: slices.Clone(labelValues)}
+		c.series[key] = s
+	}
+	s.value += v
+}
+
+// Value returns the value of the series with the given label values
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.series[seriesKey(labelValues)]; ok {
+		return s.value
+	}
+	return 0
+}
+
+// describe implements metricFamily
+func (c *Counter) describe() (string, string, []string) {
+	return "counter", c.help, c.labels
+}
+
+// write implements metricFamily
+func (c *Counter) write(w *bufio.Writer, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// A counter without labels has one series, which is 0 until it's incremented
+	if len(c.labels) == 0 && len(c.series) == 0 {
+		fmt.Fprintf(w, "%s 0\n", name)
+		return
+	}
+	for _, key := range slices.Sorted(maps.Keys(c.series)) {
+		s := c.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(c.labels, s.labels), formatMetricValue(s.value))
+	}
+}
+
+// Histogram counts observed values, such as latencies or sizes, in buckets
+type Histogram struct {
+	mu      sync.Mutex
+	help    string
+	buckets []float64
+	labels  []string
+	series  map[string]*histogramSeries
+}
+
+// histogramSeries is the state of a histogram for one set of label values
+type histogramSeries struct {
+	labels []string
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// Observe adds v to the series with the given label values, in the order of the label names
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	checkLabelValues(h.labels, labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := seriesKey(labelValues)
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labels: slices.Clone(labelValues), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+// ObserveDuration adds the duration since start, in seconds
+func (h *Histogram) ObserveDuration(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// Count returns the number of values observed in the series with the given label values
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if s, ok := h.series[seriesKey(labelValues)]; ok {
+		return s.count
+	}
+	return 0
+}
+
+// describe implements metricFamily
+func (h *Histogram) describe() (string, string, []string) {
+	return "histogram", h.help, h.labels
+}
+
+// write implements metricFamily
+func (h *Histogram) write(w *bufio.Writer, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	bucketLabels := append(slices.Clone(h.labels), "le")
+	for _, key := range slices.Sorted(maps.Keys(h.series)) {
+		s := h.series[key]
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(bucketLabels, append(slices.Clone(s.labels), formatMetricValue(bound))), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(bucketLabels, append(slices.Clone(s.labels), "+Inf")), s.count)
+
+		labels := formatLabels(h.labels, s.labels)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatMetricValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, labels, s.count)
+	}
+}
+
+// checkLabelValues panics if there isn't one value per label name
+func checkLabelValues(names, values []string) {
+	if len(names) != len(values) {
+		panic(fmt.Sprintf("toolkit: metric has labels %v, got %d values", names, len(values)))
+	}
+}
+
+// seriesKey returns the key of the series with the given label values
+func seriesKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// validMetricName reports whether name matches [a-zA-Z_:][a-zA-Z0-9_:]*
+func validMetricName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// formatLabels returns the label set of a series, such as {method="GET",status="200"}
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// escapeMetricHelp escapes the help text of a metric
+func escapeMetricHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+// formatMetricValue formats a value the way Prometheus parses it
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// registryObserver records the events of toolkit operations in a MetricsRegistry
+type registryObserver struct {
+	uploadFiles    *Counter
+	uploadBytes    *Histogram
+	uploadRejects  *Counter
+	jsonErrors     *Counter
+	responses      *Counter
+	remotePushes   *Counter
+	remoteDuration *Histogram
+}
+
+// observer returns the observer that records the toolkit's metrics in reg, registering
+// them the first time
+func (reg *MetricsRegistry) observer() *registryObserver {
+	reg.toolkitOnce.Do(func() {
+		reg.toolkit = &registryObserver{
+			uploadFiles: reg.Counter("toolkit_upload_files_total", "Files written by uploads"),
+			uploadBytes: reg.Histogram("toolkit_upload_size_bytes", "Bytes written per upload",
+				[]float64{1 << 10, 1 << 15, 1 << 20, 1 << 23, 1 << 26, 1 << 30}),
+			uploadRejects:  reg.Counter("toolkit_upload_rejected_total", "Uploads rejected before anything was written, by reason", "reason"),
+			jsonErrors:     reg.Counter("toolkit_json_read_errors_total", "Request bodies ReadJSON couldn't decode, by type of error", "type"),
+			responses:      reg.Counter("toolkit_json_responses_total", "Responses written by WriteJSON and ErrorJSON, by status code", "status"),
+			remotePushes:   reg.Counter("toolkit_remote_pushes_total", "JSON pushes to remote services, by status code, or error if the request failed", "status"),
+			remoteDuration: reg.Histogram("toolkit_remote_push_duration_seconds", "Duration of JSON pushes to remote services", nil),
+		}
+	})
+	return reg.toolkit
+}
+
+// uploadAccepted implements observer
+func (o *registryObserver) uploadAccepted(_ context.Context, files int, bytes int64) {
+	o.uploadFiles.Add(float64(files))
+	o.uploadBytes.Observe(float64(bytes))
+}
+
+// uploadRejected implements observer
+func (o *registryObserver) uploadRejected(_ context.Context, reason string) {
+	o.uploadRejects.Inc(reason)
+}
+
+// jsonReadFailed implements observer
+func (o *registryObserver) jsonReadFailed(_ context.Context, errorType string) {
+	o.jsonErrors.Inc(errorType)
+}
+
+// responseWritten implements observer
+func (o *registryObserver) responseWritten(status int) {
+	o.responses.Inc(strconv.Itoa(status))
+}
+
+// remotePushed implements observer
+func (o *registryObserver) remotePushed(_ context.Context, status int, err error, latency time.Duration) {
+	label := strconv.Itoa(status)
+	if err != nil {
+		label = "error"
+	}
+	o.remotePushes.Inc(label)
+	o.remoteDuration.Observe(latency.Seconds())
+}
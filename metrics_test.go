@@ -0,0 +1,142 @@
+package toolkit
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsRegistry_ServeHTTP(t *testing.T) {
+	registry := NewMetricsRegistry()
+
+	requests := registry.Counter("app_requests_total", "Requests served\nby route", "route", "code")
+	requests.Inc("/items", "200")
+	requests.Add(2, "/items", "200")
+	requests.Inc(`/say"hi"`, "500")
+
+	registry.Counter("app_errors_total", "Errors")
+
+	latency := registry.Histogram("app_latency_seconds", "Request latency", []float64{1, 0.1, 1, math.Inf(1)})
+	latency.Observe(0.05)
+	latency.Observe(0.1)
+	latency.Observe(3)
+
+	rr := httptest.NewRecorder()
+	registry.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	expected := `# HELP app_errors_total Errors
+# TYPE app_errors_total counter
+app_errors_total 0
+# HELP app_latency_seconds Request latency
+# TYPE app_latency_seconds histogram
+app_latency_seconds_bucket{le="0.1"} 2
+app_latency_seconds_bucket{le="1"} 2
+app_latency_seconds_bucket{le="+Inf"} 3
+app_latency_seconds_sum 3.15
+app_latency_seconds_count 3
+# HELP app_requests_total Requests served\nby route
+# TYPE app_requests_total counter
+app_requests_total{route="/items",code="200"} 3
+app_requests_total{route="/say\"hi\"",code="500"} 1
+`
+	if rr.Body.String() != expected {
+		t.Errorf("unexpected exposition:\n%s", rr.Body.String())
+	}
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %s", rr.Header().Get("Content-Type"))
+	}
+}
+
+var metricsRegisterTests = []struct {
+	name          string
+	register      func(*MetricsRegistry)
+	panicExpected bool
+}{
+	{name: "same counter", register: func(r *MetricsRegistry) { r.Counter("requests_total", "", "code") }},
+	{name: "other labels", register: func(r *MetricsRegistry) { r.Counter("requests_total", "", "route") }, panicExpected: true},
+	{name: "other kind", register: func(r *MetricsRegistry) { r.Histogram("requests_total", "", nil, "code") }, panicExpected: true},
+	{name: "invalid name", register: func(r *MetricsRegistry) { r.Counter("2xx-requests", "") }, panicExpected: true},
+	{name: "reserved label", register: func(r *MetricsRegistry) { r.Histogram("sizes", "", nil, "le") }, panicExpected: true},
+}
+
+func TestMetricsRegistry_Register(t *testing.T) {
+	for _, e := range metricsRegisterTests {
+		registry := NewMetricsRegistry()
+		counter := registry.Counter("requests_total", "", "code")
+		counter.Inc("200")
+
+		panicked := func() (panicked bool) {
+			defer func() { panicked = recover() != nil }()
+			e.register(registry)
+			return false
+		}()
+		if panicked != e.panicExpected {
+			t.Errorf("%s: expected a panic: %v, got %v", e.name, e.panicExpected, panicked)
+		}
+		if !panicked && registry.Counter("requests_total", "", "code").Value("200") != 1 {
+			t.Errorf("%s: expected the registered counter to be returned", e.name)
+		}
+	}
+}
+
+func TestTools_Metrics(t *testing.T) {
+	testTools := Tools{Metrics: NewMetricsRegistry(), Logger: slog.New(slog.DiscardHandler)}
+	observer := testTools.Metrics.observer()
+
+	// uploads
+	request := newUploadRequest(t, nil, testUploadFile{field: "file", name: "logo.png", contents: testPNG(t)})
+	if _, err := testTools.UploadFiles(request, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if observer.uploadFiles.Value() != 1 || observer.uploadBytes.Count() != 1 {
+		t.Errorf("expected one upload of one file to be counted")
+	}
+
+	// JSON read errors
+	for _, body := range []string{`{"a":`, `{"a": 1} {}`, `{"unknown": 1}`} {
+		var data struct{ A int }
+		_ = testTools.ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(body)), &data)
+	}
+	for _, errorType := range []string{"syntax", "trailing_data", "unknown_field"} {
+		if observer.jsonErrors.Value(errorType) != 1 {
+			t.Errorf("expected one %s error, got %v", errorType, observer.jsonErrors.Value(errorType))
+		}
+	}
+
+	// responses
+	_ = testTools.WriteJSON(httptest.NewRecorder(), http.StatusCreated, "ok")
+	_ = testTools.ErrorJSON(httptest.NewRecorder(), errors.New("missing"), http.StatusNotFound)
+	if observer.responses.Value("201") != 1 || observer.responses.Value("404") != 1 {
+		t.Error("expected the responses to be counted by status")
+	}
+
+	// remote pushes
+	client := NewTestClient(func(req *http.Request) *http.Response {
+		return &http.Response{StatusCode: http.StatusBadGateway, Body: io.NopCloser(strings.NewReader("")), Header: make(http.Header)}
+	})
+	_, _, _ = testTools.PushJSONToRemote("http://test.com", "data", client)
+	_, _, _ = testTools.PushJSONToRemote("://bad", "data", client)
+	if observer.remotePushes.Value("502") != 1 || observer.remoteDuration.Count() != 1 {
+		t.Error("expected the push to be counted")
+	}
+
+	// every toolkit metric is exposed
+	rr := httptest.NewRecorder()
+	testTools.Metrics.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	for _, expected := range []string{
+		`toolkit_upload_files_total 1`,
+		`toolkit_json_read_errors_total{type="syntax"} 1`,
+		`toolkit_json_responses_total{status="201"} 1`,
+		`toolkit_remote_pushes_total{status="502"} 1`,
+		`toolkit_remote_push_duration_seconds_count 1`,
+	} {
+		if !strings.Contains(rr.Body.String(), expected) {
+			t.Errorf("expected %s in:\n%s", expected, rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// RequestIDHeader is the header RequestID reads and sets
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDLength is the length of generated request IDs
+const requestIDLength = 20
+
+// maxRequestIDLength is the longest request ID accepted from a client
+const maxRequestIDLength = 128
+
+// requestIDKey is the context key of the request ID
+type requestIDKey struct{}
+
+// Chain combines middleware into one, with the first one outermost:
+// Chain(a, b)(h) is a(b(h))
+func Chain(middleware ...func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		for i := len(middleware) - 1; i >= 0; i-- {
+			next = middleware[i](next)
+		}
+		return next
+	}
+}
+
+// RequestID is middleware that gives every request an ID, taken from the X-Request-ID
+// header or made with RandomString. The ID is sent back in the same header and can be
+// read from the request context with RequestIDFromContext.
+func (t *Tools) RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = t.RandomString(requestIDLength)
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// RequestIDFromContext returns the ID given to a request by RequestID, or "" if there is none
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID reports whether a client's request ID is short and printable, so it
+// can be logged and echoed safely
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Recover is middleware that turns a panic in a handler into a 500 response written with
+// ErrorJSON, and logs it to t.Logger with its stack trace
+func (t *Tools) Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := newResponseRecorder(w)
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				// Used to abort a response on purpose; the server handles it
+				panic(v)
+			}
+
+			t.requestLogger(r).Error("panic serving request", "panic", v, "stack", string(debug.Stack()))
+
+			// Nothing can be done once the response has started
+			if !rw.wroteHeader {
+				_ = t.ErrorJSON(w, errors.New(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError)
+			}
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// AccessLog is middleware that logs every request to t.Logger with its method, path,
+// status, number of bytes written, latency and request ID
+func (t *Tools) AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := newResponseRecorder(w)
+
+		next.ServeHTTP(rw, r)
+
+		t.requestLogger(r).Info("request", "status", rw.status, "bytes", rw.bytes, "latency", time.Since(start))
+	})
+}
+
+// Timeout returns middleware that gives handlers d to answer. The context of the request is
+// canceled after d, and if the handler hasn't finished by then, the client gets a 503 written
+// with ErrorJSON and whatever the handler writes later is dropped. A panic before then is
+// passed on, and one after it is logged with its stack. Responses are buffered, so don't
+// use it for streams.
+func (t *Tools) Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+
+			go func() {
+				defer func() {
+					v := recover()
+					if v == nil {
+						return
+					}
+					tw.mu.Lock()
+					defer tw.mu.Unlock()
+
+					// After the timeout nobody is left to re-panic, so the panic is logged here
+					if !tw.timedOut {
+						panicked <- v
+					} else if v != http.ErrAbortHandler {
+						t.requestLogger(r).Error("panic serving request after timeout", "panic", v, "stack", string(debug.Stack()))
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case v := <-panicked:
+				// Let Recover or the server deal with it, as if there were no timeout
+				panic(v)
+
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				for key, values := range tw.header {
+					w.Header()[key] = values
+				}
+				if tw.status == 0 {
+					tw.status = http.StatusOK
+				}
+				w.WriteHeader(tw.status)
+				_, _ = w.Write(tw.body.Bytes())
+
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				// The handler may have panicked just before the deadline
+				select {
+				case v := <-panicked:
+					panic(v)
+				default:
+				}
+				tw.timedOut = true
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					_ = t.ErrorJSON(w, fmt.Errorf("request timed out after %s", d), http.StatusServiceUnavailable)
+				}
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers the response of a handler run by Timeout
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	body     bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+// Header implements http.ResponseWriter
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+// WriteHeader implements http.ResponseWriter
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.status == 0 && !tw.timedOut {
+		tw.status = status
+	}
+}
+
+// Write implements http.ResponseWriter. It fails once the request has timed out
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.body.Write(b)
+}
+
+// responseRecorder records the status and size of a response as it is written
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+// newResponseRecorder wraps w. Responses without an explicit status are 200s
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+// WriteHeader implements http.ResponseWriter
+func (rw *responseRecorder) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap returns the original http.ResponseWriter, for http.ResponseController
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
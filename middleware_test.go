@@ -0,0 +1,165 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTools_RequestID(t *testing.T) {
+	var testTools Tools
+
+	var seen string
+	handler := testTools.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	// a new ID is generated
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if len(seen) != requestIDLength || rr.Header().Get(RequestIDHeader) != seen {
+		t.Errorf("expected a generated ID in the context and the response, got %q and %q", seen, rr.Header().Get(RequestIDHeader))
+	}
+
+	// the client's ID is kept
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set(RequestIDHeader, "abc-123")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, request)
+	if seen != "abc-123" || rr.Header().Get(RequestIDHeader) != "abc-123" {
+		t.Errorf("expected the client's ID, got %q", seen)
+	}
+
+	// unless it isn't safe to log
+	request.Header.Set(RequestIDHeader, "bad id\n")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	if seen == "bad id\n" || len(seen) != requestIDLength {
+		t.Errorf("expected a generated ID instead of an invalid one, got %q", seen)
+	}
+}
+
+func TestTools_Recover(t *testing.T) {
+	var logs bytes.Buffer
+	testTools := Tools{Logger: slog.New(slog.NewTextHandler(&logs, nil))}
+
+	handler := Chain(testTools.RequestID, testTools.Recover)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/crash", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+	var payload JSONResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil || !payload.Error {
+		t.Errorf("expected a JSON error, got %s", rr.Body.String())
+	}
+	if !strings.Contains(logs.String(), "boom") || !strings.Contains(logs.String(), rr.Header().Get(RequestIDHeader)) {
+		t.Errorf("expected the panic to be logged with the request ID, got %s", logs.String())
+	}
+}
+
+func TestTools_AccessLog(t *testing.T) {
+	var logs bytes.Buffer
+	testTools := Tools{Logger: slog.New(slog.NewTextHandler(&logs, nil))}
+
+	handler := testTools.AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello"))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/items", nil))
+
+	for _, expected := range []string{"method=POST", "path=/items", "status=201", "bytes=5", "latency="} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Errorf("expected %s in the log, got %s", expected, logs.String())
+		}
+	}
+}
+
+// syncBuffer is a bytes.Buffer that can be written from other goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestTools_Timeout(t *testing.T) {
+	testTools := Tools{Logger: slog.New(slog.DiscardHandler)}
+
+	handler := testTools.Timeout(20 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wait, _ := time.ParseDuration(r.URL.Query().Get("wait"))
+		select {
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("X-Done", "yes")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("done"))
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/?wait=1ms", nil))
+	if rr.Code != http.StatusAccepted || rr.Body.String() != "done" || rr.Header().Get("X-Done") != "yes" {
+		t.Errorf("expected the handler's response, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/?wait=1s", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	var payload JSONResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil || !payload.Error {
+		t.Errorf("expected a JSON error, got %s", rr.Body.String())
+	}
+
+	// a panic in the handler still reaches Recover
+	handler = Chain(testTools.Recover, testTools.Timeout(time.Second))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+	// a panic after the timeout is logged with its stack
+	var logs syncBuffer
+	logged := Tools{Logger: slog.New(NewJSONLogHandler(&logs, slog.LevelInfo))}
+	handler = logged.Timeout(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		panic("late boom")
+	}))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(logs.String(), "late boom") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if out := logs.String(); !strings.Contains(out, "late boom") || !strings.Contains(out, "goroutine") {
+		t.Errorf("expected the panic to be logged with its stack, got %s", out)
+	}
+}
@@ -0,0 +1,201 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Optional is a field that tells apart a value, an explicit JSON null and a missing key,
+// for partial updates:
+//
+//	type UpdateUser struct {
+//		Name  toolkit.Optional[string]  `json:"name,omitzero"`
+//		Phone toolkit.Optional[*string] `json:"phone,omitzero"`
+//	}
+//
+// With the omitzero option, an Optional that was never set is left out when encoded,
+// and an explicit null is kept.
+type Optional[T any] struct {
+	value   T
+	present bool
+	null    bool
+}
+
+// Some returns an Optional set to v
+func Some[T any](v T) Optional[T] {
+	return Optional[T]{value: v, present: true}
+}
+
+// Null returns an Optional set to null
+func Null[T any]() Optional[T] {
+	return Optional[T]{present: true, null: true}
+}
+
+// IsSet reports whether the field was present, with a value or null
+func (o Optional[T]) IsSet() bool {
+	return o.present
+}
+
+// IsNull reports whether the field was set to null
+func (o Optional[T]) IsNull() bool {
+	return o.present && o.null
+}
+
+// Value returns the value, and whether there is one: it is false when the field is missing or null
+func (o Optional[T]) Value() (T, bool) {
+	return o.value, o.present && !o.null
+}
+
+// ValueOr returns the value, or def when the field is missing or null
+func (o Optional[T]) ValueOr(def T) T {
+	if v, ok := o.Value(); ok {
+		return v
+	}
+	return def
+}
+
+// IsZero reports whether the field is missing, so the omitzero option leaves it out
+func (o Optional[T]) IsZero() bool {
+	return !o.present
+}
+
+// MarshalJSON implements json.Marshaler. Missing fields and nulls are both encoded as null
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if !o.present || o.null {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.value)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It is only called for keys that are present
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		*o = Null[T]()
+		return nil
+	}
+
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*o = Some(v)
+	return nil
+}
+
+// Apply copies the field onto dst if it was set: a value is copied, and null sets the
+// zero value. It reports whether dst was changed.
+func (o Optional[T]) Apply(dst *T) bool {
+	if !o.present {
+		return false
+	}
+	var zero T
+	*dst = zero
+	if !o.null {
+		*dst = o.value
+	}
+	return true
+}
+
+// ApplyPtr copies the field onto a nullable dst if it was set: a value is copied, and null
+// sets dst to nil. It reports whether dst was changed.
+func (o Optional[T]) ApplyPtr(dst **T) bool {
+	if !o.present {
+		return false
+	}
+	*dst = nil
+	if !o.null {
+		v := o.value
+		*dst = &v
+	}
+	return true
+}
+
+// optionalValue is implemented by every Optional, for ApplyOptionals
+type optionalValue interface {
+	IsSet() bool
+	IsNull() bool
+	rawValue() any
+}
+
+// rawValue returns the value as an interface
+func (o Optional[T]) rawValue() any {
+	return o.value
+}
+
+// ApplyOptionals copies the Optional fields of the struct src that were set onto the fields
+// with the same name in the struct pointed to by dst, such as a database model, and returns
+// the names of the fields it changed. An `apply:"Name"` tag on a field of src picks another
+// field of dst, and `apply:"-"` skips it. Null sets the zero value, which is nil for
+// pointers. A value is copied if it is assignable to the field, or to what the field points to.
+func ApplyOptionals(src, dst any) ([]string, error) {
+	s := reflect.ValueOf(src)
+	if s.Kind() == reflect.Pointer {
+		s = s.Elem()
+	}
+	d := reflect.ValueOf(dst)
+	if s.Kind() != reflect.Struct || d.Kind() != reflect.Pointer || d.IsNil() || d.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("apply needs a struct and a non-nil pointer to a struct")
+	}
+	d = d.Elem()
+
+	// Check every field before changing any, so dst is left alone on error
+	type assignment struct {
+		field reflect.Value
+		value reflect.Value
+		name  string
+	}
+	var assignments []assignment
+
+	for i := 0; i < s.NumField(); i++ {
+		field := s.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		opt, ok := s.Field(i).Interface().(optionalValue)
+		if !ok || !opt.IsSet() {
+			continue
+		}
+
+		name := field.Name
+		if tag := field.Tag.Get("apply"); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+
+		target := d.FieldByName(name)
+		if !target.IsValid() || !target.CanSet() {
+			return nil, fmt.Errorf("field %s has no settable field %s to apply to", field.Name, name)
+		}
+
+		if opt.IsNull() {
+			assignments = append(assignments, assignment{target, reflect.Zero(target.Type()), name})
+			continue
+		}
+
+		value := reflect.ValueOf(opt.rawValue())
+		switch {
+		case !value.IsValid():
+			// A nil pointer or interface value
+			value = reflect.Zero(target.Type())
+		case value.Type().AssignableTo(target.Type()):
+		case target.Kind() == reflect.Pointer && value.Type().AssignableTo(target.Type().Elem()):
+			ptr := reflect.New(target.Type().Elem())
+			ptr.Elem().Set(value)
+			value = ptr
+		default:
+			return nil, fmt.Errorf("field %s of type %s can't be applied to %s of type %s", field.Name, value.Type(), name, target.Type())
+		}
+		assignments = append(assignments, assignment{target, value, name})
+	}
+
+	applied := make([]string, 0, len(assignments))
+	for _, a := range assignments {
+		a.field.Set(a.value)
+		applied = append(applied, a.name)
+	}
+	return applied, nil
+}
@@ -0,0 +1,128 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// updateUser is a partial update of a user
+type updateUser struct {
+	Name     Optional[string]  `json:"name,omitzero"`
+	Phone    Optional[*string] `json:"phone,omitzero"`
+	Age      Optional[int]     `json:"age,omitzero"`
+	Nickname Optional[string]  `json:"nickname,omitzero" apply:"Alias"`
+}
+
+// userModel is the stored user
+type userModel struct {
+	ID    int
+	Name  string
+	Phone *string
+	Age   *int
+	Alias string
+}
+
+func TestOptional_JSON(t *testing.T) {
+	var testTools Tools
+
+	request := httptest.NewRequest("PATCH", "/", strings.NewReader(`{"name":"Ann","phone":null}`))
+	var update updateUser
+	if err := testTools.ReadJSON(httptest.NewRecorder(), request, &update); err != nil {
+		t.Fatal(err)
+	}
+
+	if name, ok := update.Name.Value(); !ok || name != "Ann" {
+		t.Errorf("expected the name to be set, got %+v", update.Name)
+	}
+	if !update.Phone.IsSet() || !update.Phone.IsNull() {
+		t.Errorf("expected the phone to be null, got %+v", update.Phone)
+	}
+	if update.Age.IsSet() {
+		t.Errorf("expected the age to be missing, got %+v", update.Age)
+	}
+	if update.Age.ValueOr(18) != 18 {
+		t.Error("expected the default for a missing value")
+	}
+
+	// missing fields are left out, nulls are kept
+	rr := httptest.NewRecorder()
+	if err := testTools.WriteJSON(rr, 200, update); err != nil {
+		t.Fatal(err)
+	}
+	if body := rr.Body.String(); body != `{"name":"Ann","phone":null}` {
+		t.Errorf("unexpected encoding %s", body)
+	}
+
+	out, err := json.Marshal(updateUser{Age: Some(40), Nickname: Null[string]()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"age":40,"nickname":null}` {
+		t.Errorf("unexpected encoding %s", out)
+	}
+}
+
+func TestOptional_Apply(t *testing.T) {
+	phone := "555"
+	user := userModel{Name: "Ann", Phone: &phone}
+
+	if (Optional[string]{}).Apply(&user.Name) {
+		t.Error("a missing field must not be applied")
+	}
+	if !Null[string]().Apply(&user.Name) || user.Name != "" {
+		t.Errorf("null should clear the name, got %q", user.Name)
+	}
+	if !Some(30).ApplyPtr(&user.Age) || user.Age == nil || *user.Age != 30 {
+		t.Errorf("expected the age to be set, got %v", user.Age)
+	}
+	if !Null[string]().ApplyPtr(&user.Phone) || user.Phone != nil {
+		t.Errorf("null should clear the phone, got %v", user.Phone)
+	}
+}
+
+func TestApplyOptionals(t *testing.T) {
+	phone := "555"
+	user := userModel{ID: 1, Name: "Ann", Phone: &phone, Alias: "annie"}
+
+	applied, err := ApplyOptionals(updateUser{
+		Name:     Some("Bea"),
+		Phone:    Null[*string](),
+		Age:      Some(30),
+		Nickname: Some("b"),
+	}, &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(applied, []string{"Name", "Phone", "Age", "Alias"}) {
+		t.Errorf("unexpected applied fields %v", applied)
+	}
+	if user.ID != 1 || user.Name != "Bea" || user.Phone != nil || user.Age == nil || *user.Age != 30 || user.Alias != "b" {
+		t.Errorf("unexpected model %+v", user)
+	}
+
+	// missing fields are left alone
+	applied, err = ApplyOptionals(&updateUser{Nickname: Null[string]()}, &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(applied, []string{"Alias"}) || user.Name != "Bea" || user.Alias != "" {
+		t.Errorf("unexpected result %v %+v", applied, user)
+	}
+
+	// a type that doesn't fit changes nothing
+	var mismatch struct {
+		Name Optional[int]
+		ID   Optional[int]
+	}
+	mismatch.ID, mismatch.Name = Some(2), Some(5)
+	if _, err := ApplyOptionals(mismatch, &user); err == nil {
+		t.Error("expected an error for a mismatched type")
+	}
+	if user.ID != 1 {
+		t.Errorf("the model was changed by a failed apply: %+v", user)
+	}
+}
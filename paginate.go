@@ -0,0 +1,259 @@
+package toolkit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Page limits used when Tools.DefaultPageLimit and Tools.MaxPageLimit are zero
+const (
+	defaultPageLimit = 20
+	defaultMaxLimit  = 100
+)
+
+// ErrInvalidCursor is returned by ParsePage for cursors that weren't issued with
+// Tools.CursorSecret, or were changed by the client
+var ErrInvalidCursor error = &RequestError{Status: http.StatusBadRequest, Field: "cursor", Msg: "cursor is invalid"}
+
+// ErrNoCursorSecret is returned by ParsePage and WritePage for keyset cursors when
+// Tools.CursorSecret isn't set. It is a server misconfiguration, so ErrorJSON sends a 500.
+var ErrNoCursorSecret error = &RequestError{Status: http.StatusInternalServerError, Msg: "a cursor secret is required for keyset pagination"}
+
+// PageRequest is the page asked for by a request, read by ParsePage. Offset pagination
+// uses Offset; keyset pagination uses the key of the cursor, if there is one.
+type PageRequest struct {
+	Limit  int
+	Offset int
+	// Before is set for a keyset cursor pointing backward: the page holds the items just
+	// before the cursor key, rather than just after it
+	Before bool
+
+	key json.RawMessage
+}
+
+// HasCursor reports whether the request has a keyset cursor. The first page doesn't
+func (p PageRequest) HasCursor() bool {
+	return p.key != nil
+}
+
+// CursorKey decodes the key of the cursor, as passed to WritePage in PageResult.FirstKey
+// or LastKey, into dst
+func (p PageRequest) CursorKey(dst any) error {
+	if p.key == nil {
+		return errors.New("page request has no cursor")
+	}
+	return json.Unmarshal(p.key, dst)
+}
+
+// cursorPayload is the signed content of a cursor
+type cursorPayload struct {
+	Key    json.RawMessage `json:"k"`
+	Before bool            `json:"b,omitempty"`
+}
+
+// ParsePage reads the limit, offset and cursor query parameters of r. The limit defaults
+// to t.DefaultPageLimit (20) and can't be larger than t.MaxPageLimit (100). The offset
+// and the cursor can't be used together. Invalid parameters are returned as a *RequestError.
+func (t *Tools) ParsePage(r *http.Request) (PageRequest, error) {
+	query := r.URL.Query()
+	page := PageRequest{Limit: t.DefaultPageLimit}
+	if page.Limit <= 0 {
+		page.Limit = defaultPageLimit
+	}
+	maxLimit := t.MaxPageLimit
+	if maxLimit <= 0 {
+		maxLimit = defaultMaxLimit
+	}
+
+	if s := query.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 {
+			return PageRequest{}, &RequestError{Status: http.StatusBadRequest, Field: "limit", Msg: "limit must be a positive integer"}
+		}
+		if limit > maxLimit {
+			return PageRequest{}, &RequestError{Status: http.StatusBadRequest, Field: "limit", Msg: fmt.Sprintf("limit must not be larger than %d", maxLimit)}
+		}
+		page.Limit = limit
+	}
+	page.Limit = min(page.Limit, maxLimit)
+
+	offset, cursor := query.Get("offset"), query.Get("cursor")
+	if offset != "" && cursor != "" {
+		return PageRequest{}, &RequestError{Status: http.StatusBadRequest, Field: "offset", Msg: "offset and cursor can't be used together"}
+	}
+
+	if offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return PageRequest{}, &RequestError{Status: http.StatusBadRequest, Field: "offset", Msg: "offset must be a non-negative integer"}
+		}
+		page.Offset = n
+	}
+
+	if cursor != "" {
+		payload, err := t.decodeCursor(cursor)
+		if err != nil {
+			return PageRequest{}, err
+		}
+		page.key, page.Before = payload.Key, payload.Before
+	}
+	return page, nil
+}
+
+// encodeCursor signs a cursor payload and encodes it as url-safe base64
+func (t *Tools) encodeCursor(payload cursorPayload) (string, error) {
+	if len(t.CursorSecret) == 0 {
+		return "", ErrNoCursorSecret
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, t.CursorSecret)
+	mac.Write(data)
+
+	return base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// decodeCursor checks the signature of a cursor and returns its payload
+func (t *Tools) decodeCursor(cursor string) (cursorPayload, error) {
+	var payload cursorPayload
+	if len(t.CursorSecret) == 0 {
+		return payload, ErrNoCursorSecret
+	}
+
+	encoded, signature, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return payload, ErrInvalidCursor
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return payload, ErrInvalidCursor
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return payload, ErrInvalidCursor
+	}
+
+	mac := hmac.New(sha256.New, t.CursorSecret)
+	mac.Write(data)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return payload, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(data, &payload); err != nil || payload.Key == nil {
+		return payload, ErrInvalidCursor
+	}
+	return payload, nil
+}
+
+// PageResult is one page of items, passed to WritePage
+type PageResult struct {
+	Data any
+	// HasMore reports whether there are items after this page, or before it when the
+	// request was for a backward keyset page
+	HasMore bool
+	// FirstKey and LastKey are the sort keys of the first and last items of the page,
+	// for keyset pagination, such as an ID or a struct with a date and an ID. Leave them
+	// nil for offset pagination
+	FirstKey any
+	LastKey  any
+}
+
+// PageResponse is the body written by WritePage. Next and Prev are the URLs of the
+// next and previous pages, if there are any
+type PageResponse struct {
+	Data any    `json:"data"`
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// WritePage writes a page of items as JSON, with the URLs of the next and previous pages
+// in the body and in an RFC 8288 Link header. Keyset pagination is used when the page has
+// keys or the request had a cursor: items are sorted by key, and a backward page must hold
+// the items just before the cursor key, in the same order. Otherwise offsets are used.
+func (t *Tools) WritePage(w http.ResponseWriter, r *http.Request, page PageRequest, result PageResult, headers ...http.Header) error {
+	resp := PageResponse{Data: result.Data}
+
+	switch {
+	case result.FirstKey != nil || result.LastKey != nil:
+		// For a forward page, the previous page exists if we came from a cursor; for a
+		// backward page, the next page does
+		hasNext, hasPrev := result.HasMore, page.HasCursor()
+		if page.Before {
+			hasNext, hasPrev = true, result.HasMore
+		}
+
+		var err error
+		if hasNext {
+			if resp.Next, err = t.cursorURL(r, page, cursorPayload{}, result.LastKey); err != nil {
+				return err
+			}
+		}
+		if hasPrev {
+			if resp.Prev, err = t.cursorURL(r, page, cursorPayload{Before: true}, result.FirstKey); err != nil {
+				return err
+			}
+		}
+
+	case !page.HasCursor():
+		if result.HasMore {
+			resp.Next = pageURL(r, page.Limit, "offset", strconv.Itoa(page.Offset+page.Limit))
+		}
+		if page.Offset > 0 {
+			resp.Prev = pageURL(r, page.Limit, "offset", strconv.Itoa(max(page.Offset-page.Limit, 0)))
+		}
+	}
+
+	header := http.Header{}
+	if len(headers) > 0 {
+		header = headers[0].Clone()
+	}
+	var links []string
+	if resp.Next != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, resp.Next))
+	}
+	if resp.Prev != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, resp.Prev))
+	}
+	if len(links) > 0 {
+		header.Set("Link", strings.Join(links, ", "))
+	}
+
+	return t.WriteJSON(w, http.StatusOK, resp, header)
+}
+
+// cursorURL returns the URL of the page at a cursor for key
+func (t *Tools) cursorURL(r *http.Request, page PageRequest, payload cursorPayload, key any) (string, error) {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	payload.Key = data
+
+	cursor, err := t.encodeCursor(payload)
+	if err != nil {
+		return "", err
+	}
+	return pageURL(r, page.Limit, "cursor", cursor), nil
+}
+
+// pageURL returns the path and query of r with the limit and one of offset or cursor set
+func pageURL(r *http.Request, limit int, param, value string) string {
+	u := *r.URL
+	query := u.Query()
+	query.Del("offset")
+	query.Del("cursor")
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set(param, value)
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
@@ -0,0 +1,218 @@
+package toolkit
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var parsePageTests = []struct {
+	name           string
+	query          string
+	expectedLimit  int
+	expectedOffset int
+	errorExpected  bool
+}{
+	{name: "defaults", query: "", expectedLimit: 20},
+	{name: "limit and offset", query: "?limit=5&offset=10", expectedLimit: 5, expectedOffset: 10},
+	{name: "zero limit", query: "?limit=0", errorExpected: true},
+	{name: "limit not a number", query: "?limit=ten", errorExpected: true},
+	{name: "limit too large", query: "?limit=101", errorExpected: true},
+	{name: "negative offset", query: "?offset=-1", errorExpected: true},
+	{name: "offset and cursor", query: "?offset=1&cursor=abc", errorExpected: true},
+	{name: "bad cursor", query: "?cursor=abc.def", errorExpected: true},
+}
+
+func TestTools_ParsePage(t *testing.T) {
+	testTools := Tools{CursorSecret: []byte("secret")}
+
+	for _, e := range parsePageTests {
+		page, err := testTools.ParsePage(httptest.NewRequest("GET", "/items"+e.query, nil))
+		if e.errorExpected {
+			if err == nil {
+				t.Errorf("%s: expected an error", e.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+			continue
+		}
+		if page.Limit != e.expectedLimit || page.Offset != e.expectedOffset || page.HasCursor() {
+			t.Errorf("%s: unexpected page %+v", e.name, page)
+		}
+	}
+}
+
+func TestTools_Cursor(t *testing.T) {
+	testTools := Tools{CursorSecret: []byte("secret")}
+
+	cursor, err := testTools.encodeCursor(cursorPayload{Key: json.RawMessage(`{"id":42}`), Before: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := testTools.ParsePage(httptest.NewRequest("GET", "/items?cursor="+cursor, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var key struct{ ID int }
+	if err := page.CursorKey(&key); err != nil || key.ID != 42 || !page.Before {
+		t.Errorf("unexpected cursor %+v %+v %v", page, key, err)
+	}
+
+	// a cursor changed by the client
+	payload, signature, _ := strings.Cut(cursor, ".")
+	data, _ := json.Marshal(cursorPayload{Key: json.RawMessage(`{"id":43}`)})
+	forged := base64.RawURLEncoding.EncodeToString(data) + "." + signature
+	if _, err := testTools.ParsePage(httptest.NewRequest("GET", "/items?cursor="+forged, nil)); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor for a forged cursor, got %v", err)
+	}
+
+	// a cursor signed with another secret
+	other := Tools{CursorSecret: []byte("other")}
+	if _, err := other.ParsePage(httptest.NewRequest("GET", "/items?cursor="+payload+"."+signature, nil)); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor for another secret, got %v", err)
+	}
+}
+
+func TestTools_WritePageOffset(t *testing.T) {
+	var testTools Tools
+
+	request := httptest.NewRequest("GET", "/items?limit=10&offset=15&sort=name", nil)
+	page, err := testTools.ParsePage(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	if err := testTools.WritePage(rr, request, page, PageResult{Data: []int{1, 2}, HasMore: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var resp PageResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Next != "/items?limit=10&offset=25&sort=name" || resp.Prev != "/items?limit=10&offset=5&sort=name" {
+		t.Errorf("unexpected links %q %q", resp.Next, resp.Prev)
+	}
+	expected := `</items?limit=10&offset=25&sort=name>; rel="next", </items?limit=10&offset=5&sort=name>; rel="prev"`
+	if link := rr.Header().Get("Link"); link != expected {
+		t.Errorf("unexpected Link header %s", link)
+	}
+
+	// the first page has no previous page, and the last no next page
+	request = httptest.NewRequest("GET", "/items", nil)
+	page, _ = testTools.ParsePage(request)
+	rr = httptest.NewRecorder()
+	if err := testTools.WritePage(rr, request, page, PageResult{Data: []int{}}); err != nil {
+		t.Fatal(err)
+	}
+	if body := strings.TrimSpace(rr.Body.String()); body != `{"data":[]}` || rr.Header().Get("Link") != "" {
+		t.Errorf("unexpected single page %s %q", body, rr.Header().Get("Link"))
+	}
+}
+
+func TestTools_WritePageKeyset(t *testing.T) {
+	testTools := Tools{CursorSecret: []byte("secret")}
+	items := []int{1, 2, 3, 4, 5, 6, 7}
+
+	// fetch returns the page of items for a request, the way a handler would query a database
+	fetch := func(page PageRequest) PageResult {
+		var selected []int
+		switch {
+		case !page.HasCursor():
+			selected = items[:min(page.Limit, len(items))]
+		case page.Before:
+			var key int
+			_ = page.CursorKey(&key)
+			start := max(key-1-page.Limit, 0)
+			selected = items[start : key-1]
+		default:
+			var key int
+			_ = page.CursorKey(&key)
+			selected = items[key:min(key+page.Limit, len(items))]
+		}
+
+		result := PageResult{Data: selected}
+		if len(selected) > 0 {
+			result.FirstKey, result.LastKey = selected[0], selected[len(selected)-1]
+			if page.Before {
+				result.HasMore = selected[0] > items[0]
+			} else {
+				result.HasMore = selected[len(selected)-1] < items[len(items)-1]
+			}
+		}
+		return result
+	}
+
+	get := func(url string) PageResponse {
+		t.Helper()
+		request := httptest.NewRequest("GET", url, nil)
+		page, err := testTools.ParsePage(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		if err := testTools.WritePage(rr, request, page, fetch(page)); err != nil {
+			t.Fatal(err)
+		}
+		var resp PageResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// walk forward to the end, then back to the start
+	var pages []string
+	resp := get("/items?limit=3")
+	for {
+		data, _ := json.Marshal(resp.Data)
+		pages = append(pages, string(data))
+		if resp.Next == "" {
+			break
+		}
+		resp = get(resp.Next)
+	}
+	if strings.Join(pages, " ") != "[1,2,3] [4,5,6] [7]" {
+		t.Errorf("unexpected forward pages %v", pages)
+	}
+
+	pages = nil
+	for resp.Prev != "" {
+		resp = get(resp.Prev)
+		data, _ := json.Marshal(resp.Data)
+		pages = append(pages, string(data))
+	}
+	if strings.Join(pages, " ") != "[4,5,6] [1,2,3]" {
+		t.Errorf("unexpected backward pages %v", pages)
+	}
+	if resp.Next == "" {
+		t.Error("expected a next page after walking back")
+	}
+
+	// without a secret, keyset links can't be issued
+	var noSecret Tools
+	request := httptest.NewRequest("GET", "/items?limit=3", nil)
+	page, _ := noSecret.ParsePage(request)
+	err := noSecret.WritePage(httptest.NewRecorder(), request, page, fetch(page))
+	if !errors.Is(err, ErrNoCursorSecret) {
+		t.Errorf("expected ErrNoCursorSecret, got %v", err)
+	}
+
+	// which is the server's fault, not the client's
+	rr := httptest.NewRecorder()
+	_ = noSecret.ErrorJSON(rr, err)
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+	if _, err := noSecret.ParsePage(httptest.NewRequest("GET", "/items?cursor=abc.def", nil)); !errors.Is(err, ErrNoCursorSecret) {
+		t.Errorf("expected ErrNoCursorSecret for a cursor, got %v", err)
+	}
+}
@@ -0,0 +1,561 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Media types of the patch documents read by ReadPatch
+const (
+	// PatchTypeJSON is a JSON Patch (RFC 6902): a list of operations
+	PatchTypeJSON = "application/json-patch+json"
+	// PatchTypeMerge is a JSON Merge Patch (RFC 7396): a partial document, where null removes a member
+	PatchTypeMerge = "application/merge-patch+json"
+)
+
+// ErrUnsupportedPatchType is returned by ReadPatch for requests that aren't a JSON Patch
+// or a JSON Merge Patch. Its status code is 415 Unsupported Media Type.
+var ErrUnsupportedPatchType error = &RequestError{
+	Status: http.StatusUnsupportedMediaType,
+	Msg:    fmt.Sprintf("content type must be %s or %s", PatchTypeJSON, PatchTypeMerge),
+}
+
+// ErrPatchTestFailed is wrapped by the *PatchError of a test operation whose value didn't match.
+// Clients use test operations to make sure a document hasn't changed since they read it.
+var ErrPatchTestFailed = errors.New("test failed")
+
+// PatchOperation is one operation of a JSON Patch
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// PatchError is returned when a patch can't be applied. Nothing is changed in that case.
+type PatchError struct {
+	// Index of the failed operation of a JSON Patch
+	Index int
+	Op    string
+	Path  string
+	Err   error
+}
+
+// Error implements the error interface
+func (e *PatchError) Error() string {
+	return fmt.Sprintf("patch operation %d (%s %s): %s", e.Index, e.Op, e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *PatchError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the HTTP status code to send for the error: 409 when a test
+// operation failed, and 422 otherwise
+func (e *PatchError) StatusCode() int {
+	if errors.Is(e.Err, ErrPatchTestFailed) {
+		return http.StatusConflict
+	}
+	return http.StatusUnprocessableEntity
+}
+
+// Patch is a JSON Patch or a JSON Merge Patch read by ReadPatch
+type Patch struct {
+	// ContentType is PatchTypeJSON or PatchTypeMerge
+	ContentType string
+	// Operations of a JSON Patch
+	Operations []PatchOperation
+	// Merge is the document of a JSON Merge Patch
+	Merge json.RawMessage
+
+	allowUnknownFields bool
+}
+
+// ReadPatch reads a JSON Patch or a JSON Merge Patch from the body of r, chosen by its
+// Content-Type, with the same size limit and error messages as ReadJSON
+func (t *Tools) ReadPatch(w http.ResponseWriter, r *http.Request) (patch *Patch, err error) {
+	ctx, span := t.startSpan(r.Context(), "toolkit.ReadPatch")
+	defer func() { endSpan(span, err) }()
+	r = r.WithContext(ctx)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != PatchTypeJSON && mediaType != PatchTypeMerge {
+		return nil, ErrUnsupportedPatchType
+	}
+
+	var body json.RawMessage
+	if err := t.ReadJSON(w, r, &body); err != nil {
+		return nil, err
+	}
+
+	patch = &Patch{ContentType: mediaType, allowUnknownFields: t.AllowUnknownFields}
+	if mediaType == PatchTypeMerge {
+		patch.Merge = body
+		return patch, nil
+	}
+
+	// RFC 6902 says members an operation doesn't define are ignored
+	if err := json.Unmarshal(body, &patch.Operations); err != nil {
+		return nil, &RequestError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("body must be a list of patch operations: %s", err)}
+	}
+	for i, op := range patch.Operations {
+		if err := op.validate(); err != nil {
+			return nil, &PatchError{Index: i, Op: op.Op, Path: op.Path, Err: err}
+		}
+	}
+	return patch, nil
+}
+
+// validate checks that an operation has the members its kind needs
+func (op PatchOperation) validate() error {
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return errors.New("value is required")
+		}
+	case "move", "copy":
+		if _, err := parsePointer(op.From); err != nil {
+			return fmt.Errorf("from: %w", err)
+		}
+	case "remove":
+	default:
+		return fmt.Errorf("unknown operation %q", op.Op)
+	}
+	_, err := parsePointer(op.Path)
+	return err
+}
+
+// ApplyJSON applies the patch to a JSON document and returns the patched document and
+// the JSON pointers that changed. The document passed in is not modified.
+func (p *Patch) ApplyJSON(doc []byte) ([]byte, []string, error) {
+	before, err := decodeJSONValue(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, err := decodeJSONValue(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if p.ContentType == PatchTypeMerge {
+		patch, err := decodeJSONValue(p.Merge)
+		if err != nil {
+			return nil, nil, err
+		}
+		after = mergePatch(after, patch)
+	} else {
+		for i, op := range p.Operations {
+			after, err = applyOperation(after, op)
+			if err != nil {
+				return nil, nil, &PatchError{Index: i, Op: op.Op, Path: op.Path, Err: err}
+			}
+		}
+	}
+
+	out, err := json.Marshal(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var changed []string
+	diffJSON(before, after, "", &changed)
+	slices.Sort(changed)
+	return out, changed, nil
+}
+
+// Apply applies the patch to the struct pointed to by target, and returns the JSON pointers
+// that changed. The patched value is decoded with the same unknown field rule as ReadJSON,
+// and if it has a Validate() error method, it must pass before target is changed.
+// Fields that aren't encoded as JSON keep their values.
+func (p *Patch) Apply(target any) ([]string, error) {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return nil, errors.New("patch target must be a non-nil pointer")
+	}
+
+	doc, err := json.Marshal(target)
+	if err != nil {
+		return nil, err
+	}
+	patched, changed, err := p.ApplyJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode into a copy, so target is untouched if the result is invalid
+	result := reflect.New(v.Elem().Type())
+	result.Elem().Set(v.Elem())
+	clearJSONFields(result.Elem())
+
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	if !p.allowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(result.Interface()); err != nil {
+		return nil, fmt.Errorf("patched document doesn't fit the target: %w", err)
+	}
+
+	if validator, ok := result.Interface().(interface{ Validate() error }); ok {
+		if err := validator.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	v.Elem().Set(result.Elem())
+	return changed, nil
+}
+
+// clearJSONFields zeroes the fields of a struct that are encoded as JSON, so decoding
+// into it gives the same result as decoding into a new value
+func clearJSONFields(v reflect.Value) {
+	if v.Kind() != reflect.Struct {
+		v.SetZero()
+		return
+	}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.IsExported() && field.Tag.Get("json") != "-" {
+			v.Field(i).SetZero()
+		}
+	}
+}
+
+// decodeJSONValue decodes a document into maps, slices and json.Numbers
+func decodeJSONValue(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// mergePatch applies a JSON Merge Patch as described in RFC 7396
+func mergePatch(target, patch any) any {
+	members, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	doc, ok := target.(map[string]any)
+	if !ok {
+		doc = map[string]any{}
+	}
+	for key, value := range members {
+		if value == nil {
+			delete(doc, key)
+		} else {
+			doc[key] = mergePatch(doc[key], value)
+		}
+	}
+	return doc
+}
+
+// applyOperation applies one JSON Patch operation and returns the new document
+func applyOperation(doc any, op PatchOperation) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	if op.Value != nil {
+		if value, err = decodeJSONValue(op.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return addValue(doc, path, value)
+
+	case "remove":
+		doc, _, err = removeValue(doc, path)
+		return doc, err
+
+	case "replace":
+		if len(path) == 0 {
+			return value, nil
+		}
+		if doc, _, err = removeValue(doc, path); err != nil {
+			return nil, err
+		}
+		return addValue(doc, path, value)
+
+	case "move":
+		from, _ := parsePointer(op.From)
+		if len(path) > len(from) && slices.Equal(path[:len(from)], from) {
+			return nil, errors.New("a value can't be moved into one of its children")
+		}
+		doc, value, err = removeValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return addValue(doc, path, value)
+
+	case "copy":
+		from, _ := parsePointer(op.From)
+		value, err := getValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return addValue(doc, path, copyJSONValue(value))
+
+	case "test":
+		current, err := getValue(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equalJSONValues(current, value) {
+			return nil, ErrPatchTestFailed
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// parsePointer splits a JSON pointer (RFC 6901) into its unescaped tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// escapePointerToken escapes a member name for use in a JSON pointer
+func escapePointerToken(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
+
+// arrayIndex parses an array index token. "-", the end of the array, is only allowed when adding
+func arrayIndex(token string, length int, adding bool) (int, error) {
+	if token == "-" && adding {
+		return length, nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	i, err := strconv.Atoi(token)
+	limit := length - 1
+	if adding {
+		limit = length
+	}
+	if err != nil || i < 0 || i > limit {
+		return 0, fmt.Errorf("array index %q is out of range", token)
+	}
+	return i, nil
+}
+
+// getValue returns the value at path
+func getValue(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			doc = value
+		case []any:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("%q can't be found in a scalar value", token)
+		}
+	}
+	return doc, nil
+}
+
+// updateParent calls fn with the container that holds the last token of path, and
+// stores what fn returns in its place. It returns the new document.
+func updateParent(doc any, path []string, fn func(parent any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("member %q does not exist", path[0])
+		}
+		child, err := updateParent(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[path[0]] = child
+		return node, nil
+	case []any:
+		i, err := arrayIndex(path[0], len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := updateParent(node[i], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	}
+	return nil, fmt.Errorf("%q can't be found in a scalar value", path[0])
+}
+
+// addValue adds value at path, replacing an existing member or inserting into an array
+func addValue(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return updateParent(doc, path, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			node[token] = value
+			return node, nil
+		case []any:
+			i, err := arrayIndex(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			return slices.Insert(node, i, value), nil
+		}
+		return nil, fmt.Errorf("%q can't be added to a scalar value", token)
+	})
+}
+
+// removeValue removes the value at path and returns the new document and the removed value
+func removeValue(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, doc, errors.New("the whole document can't be removed")
+	}
+
+	var removed any
+	doc, err := updateParent(doc, path, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			removed = value
+			delete(node, token)
+			return node, nil
+		case []any:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = node[i]
+			return slices.Delete(node, i, i+1), nil
+		}
+		return nil, fmt.Errorf("%q can't be removed from a scalar value", token)
+	})
+	return doc, removed, err
+}
+
+// copyJSONValue returns a deep copy of a decoded value
+func copyJSONValue(v any) any {
+	switch node := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(node))
+		for key, value := range node {
+			out[key] = copyJSONValue(value)
+		}
+		return out
+	case []any:
+		out := make([]any, len(node))
+		for i, value := range node {
+			out[i] = copyJSONValue(value)
+		}
+		return out
+	}
+	return v
+}
+
+// equalJSONValues compares decoded values, with numbers compared by value, so 1 equals 1.0
+func equalJSONValues(a, b any) bool {
+	switch x := a.(type) {
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			other, ok := y[key]
+			if !ok || !equalJSONValues(value, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equalJSONValues(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		m, okX := new(big.Rat).SetString(x.String())
+		n, okY := new(big.Rat).SetString(y.String())
+		return okX && okY && m.Cmp(n) == 0
+	}
+	return a == b
+}
+
+// diffJSON appends the pointers of the values that differ between a and b. Objects are
+// compared member by member; other values, including arrays, as a whole.
+func diffJSON(a, b any, pointer string, changed *[]string) {
+	x, okX := a.(map[string]any)
+	y, okY := b.(map[string]any)
+	if !okX || !okY {
+		if !equalJSONValues(a, b) {
+			*changed = append(*changed, pointer)
+		}
+		return
+	}
+
+	for key, value := range x {
+		other, ok := y[key]
+		if !ok {
+			*changed = append(*changed, pointer+"/"+escapePointerToken(key))
+			continue
+		}
+		diffJSON(value, other, pointer+"/"+escapePointerToken(key), changed)
+	}
+	for key := range y {
+		if _, ok := x[key]; !ok {
+			*changed = append(*changed, pointer+"/"+escapePointerToken(key))
+		}
+	}
+}
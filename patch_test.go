@@ -0,0 +1,167 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var jsonPatchTests = []struct {
+	name     string
+	doc      string
+	patch    string
+	expected string
+	changed  []string
+	fails    bool
+}{
+	{name: "add member", doc: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz","value":"qux"}]`, expected: `{"baz":"qux","foo":"bar"}`, changed: []string{"/baz"}},
+	{name: "add to array", doc: `{"foo":["bar","baz"]}`, patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`, expected: `{"foo":["bar","qux","baz"]}`, changed: []string{"/foo"}},
+	{name: "append to array", doc: `{"foo":[1]}`, patch: `[{"op":"add","path":"/foo/-","value":2}]`, expected: `{"foo":[1,2]}`, changed: []string{"/foo"}},
+	{name: "remove", doc: `{"baz":"qux","foo":"bar"}`, patch: `[{"op":"remove","path":"/baz"}]`, expected: `{"foo":"bar"}`, changed: []string{"/baz"}},
+	{name: "replace", doc: `{"baz":"qux","foo":"bar"}`, patch: `[{"op":"replace","path":"/baz","value":"boo"}]`, expected: `{"baz":"boo","foo":"bar"}`, changed: []string{"/baz"}},
+	{name: "move", doc: `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, patch: `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, expected: `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, changed: []string{"/foo/waldo", "/qux/thud"}},
+	{name: "copy", doc: `{"a":{"b":1}}`, patch: `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, expected: `{"a":{"b":1},"c":{"b":2}}`, changed: []string{"/c"}},
+	{name: "escaped pointer", doc: `{"a/b":1,"m~n":2}`, patch: `[{"op":"replace","path":"/a~1b","value":3}]`, expected: `{"a/b":3,"m~n":2}`, changed: []string{"/a~1b"}},
+	{name: "replace the document", doc: `{"a":1}`, patch: `[{"op":"replace","path":"","value":[1]}]`, expected: `[1]`, changed: []string{""}},
+	{name: "test passes", doc: `{"version":1,"name":"a"}`, patch: `[{"op":"test","path":"/version","value":1.0},{"op":"replace","path":"/name","value":"b"}]`, expected: `{"name":"b","version":1}`, changed: []string{"/name"}},
+	{name: "test fails", doc: `{"version":2}`, patch: `[{"op":"test","path":"/version","value":1}]`, fails: true},
+	{name: "missing member", doc: `{"foo":"bar"}`, patch: `[{"op":"remove","path":"/baz"}]`, fails: true},
+	{name: "index out of range", doc: `{"foo":[1]}`, patch: `[{"op":"add","path":"/foo/5","value":2}]`, fails: true},
+	{name: "move into child", doc: `{"a":{"b":{}}}`, patch: `[{"op":"move","from":"/a","path":"/a/b/c"}]`, fails: true},
+}
+
+func TestPatch_ApplyJSON(t *testing.T) {
+	for _, e := range jsonPatchTests {
+		var patch Patch
+		patch.ContentType = PatchTypeJSON
+		if err := json.Unmarshal([]byte(e.patch), &patch.Operations); err != nil {
+			t.Fatal(err)
+		}
+
+		out, changed, err := patch.ApplyJSON([]byte(e.doc))
+		if e.fails {
+			var patchErr *PatchError
+			if !errors.As(err, &patchErr) {
+				t.Errorf("%s: expected a *PatchError, got %v", e.name, err)
+			} else if strings.HasPrefix(e.patch, `[{"op":"test"`) && patchErr.StatusCode() != http.StatusConflict {
+				t.Errorf("%s: expected a failed test with status 409, got %v", e.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+			continue
+		}
+		if string(out) != e.expected {
+			t.Errorf("%s: expected %s, got %s", e.name, e.expected, out)
+		}
+		if !slices.Equal(changed, e.changed) {
+			t.Errorf("%s: expected changes %v, got %v", e.name, e.changed, changed)
+		}
+	}
+}
+
+func TestPatch_ApplyJSONMerge(t *testing.T) {
+	patch := Patch{
+		ContentType: PatchTypeMerge,
+		Merge:       json.RawMessage(`{"title":"Hello!","author":{"familyName":null},"phoneNumber":"+01-123-456-7890","tags":["example"]}`),
+	}
+	doc := `{"title":"Goodbye!","author":{"givenName":"John","familyName":"Doe"},"tags":["example","sample"],"content":"This will be unchanged"}`
+
+	out, changed, err := patch.ApplyJSON([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"author":{"givenName":"John"},"content":"This will be unchanged","phoneNumber":"+01-123-456-7890","tags":["example"],"title":"Hello!"}`
+	if string(out) != expected {
+		t.Errorf("expected %s, got %s", expected, out)
+	}
+	if want := []string{"/author/familyName", "/phoneNumber", "/tags", "/title"}; !slices.Equal(changed, want) {
+		t.Errorf("expected changes %v, got %v", want, changed)
+	}
+}
+
+// patchTarget is a patch target with a field that isn't encoded and a validation rule
+type patchTarget struct {
+	Name   string   `json:"name"`
+	Age    int      `json:"age"`
+	Tags   []string `json:"tags,omitempty"`
+	secret string
+}
+
+func (p *patchTarget) Validate() error {
+	if p.Age < 0 {
+		return errors.New("age must not be negative")
+	}
+	return nil
+}
+
+func TestTools_ReadPatch(t *testing.T) {
+	var testTools Tools
+
+	read := func(contentType, body string) (*Patch, error) {
+		request := httptest.NewRequest("PATCH", "/", strings.NewReader(body))
+		request.Header.Set("Content-Type", contentType)
+		return testTools.ReadPatch(httptest.NewRecorder(), request)
+	}
+
+	if _, err := read("application/json", `{}`); !errors.Is(err, ErrUnsupportedPatchType) {
+		t.Errorf("expected ErrUnsupportedPatchType, got %v", err)
+	}
+	if _, err := read(PatchTypeJSON, `[{"op":"frobnicate","path":"/a"}]`); err == nil {
+		t.Error("expected an error for an unknown operation")
+	}
+	if _, err := read(PatchTypeJSON, `[{"op":"add","path":"/a"}]`); err == nil {
+		t.Error("expected an error for an add without a value")
+	}
+	if _, err := read(PatchTypeJSON, `[{"op":"remove","path":"/a","comment":"extra members are ignored"}]`); err != nil {
+		t.Errorf("expected members an operation doesn't define to be ignored, got %v", err)
+	}
+	if _, err := read(PatchTypeMerge, `{"name":`); err == nil {
+		t.Error("expected an error for badly-formed JSON")
+	}
+
+	target := patchTarget{Name: "Ann", Age: 30, Tags: []string{"a"}, secret: "kept"}
+
+	// a merge patch leaves omitted fields alone, and null clears a field
+	patch, err := read(PatchTypeMerge+"; charset=utf-8", `{"age":31,"tags":null}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err := patch.Apply(&target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Name != "Ann" || target.Age != 31 || target.Tags != nil || target.secret != "kept" {
+		t.Errorf("unexpected target %+v", target)
+	}
+	if !slices.Equal(changed, []string{"/age", "/tags"}) {
+		t.Errorf("unexpected changes %v", changed)
+	}
+
+	// an invalid result leaves the target unchanged
+	patch, err = read(PatchTypeJSON, `[{"op":"replace","path":"/age","value":-1}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := patch.Apply(&target); err == nil {
+		t.Error("expected a validation error")
+	}
+	if target.Age != 31 {
+		t.Errorf("the target was changed by a failed patch: %+v", target)
+	}
+
+	// a field the target doesn't have
+	patch, err = read(PatchTypeJSON, `[{"op":"add","path":"/email","value":"a@example.com"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := patch.Apply(&target); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
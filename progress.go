@@ -0,0 +1,299 @@
+package toolkit
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Stages of an upload reported in UploadProgress
+const (
+	// ProgressReceiving is reported while the request body is read from the client
+	ProgressReceiving = "receiving"
+	// ProgressWriting is reported while files are written to the upload directory
+	ProgressWriting = "writing"
+	// ProgressDone is reported once, when every file has been written
+	ProgressDone = "done"
+	// ProgressFailed is reported once, when the upload fails
+	ProgressFailed = "failed"
+)
+
+// progressInterval is the number of bytes between two progress reports
+const progressInterval = 64 * 1024
+
+// UploadProgress is passed to Tools.OnUploadProgress while UploadFiles runs
+type UploadProgress struct {
+	// UploadID identifies the upload; see UploadID
+	UploadID string `json:"upload_id"`
+	Stage    string `json:"stage"`
+	// Received is the number of request bytes read so far, out of ContentLength (-1 if unknown)
+	Received      int64 `json:"received"`
+	ContentLength int64 `json:"content_length"`
+	// File is the original name of the file being written, with FileBytes written out of FileSize
+	File      string `json:"file,omitempty"`
+	FileBytes int64  `json:"file_bytes"`
+	FileSize  int64  `json:"file_size"`
+	// Written is the number of bytes written for all files so far, out of TotalSize
+	Written   int64 `json:"written"`
+	TotalSize int64 `json:"total_size"`
+	// Error is set when Stage is ProgressFailed
+	Error string `json:"error,omitempty"`
+}
+
+// UploadID returns the ID a client gave an upload, from the upload_id query parameter
+// or the X-Upload-ID header, so progress can be followed from another connection
+func UploadID(r *http.Request) string {
+	if id := r.URL.Query().Get("upload_id"); id != "" {
+		return id
+	}
+	return r.Header.Get("X-Upload-ID")
+}
+
+// uploadProgress tracks and reports the progress of one upload. A nil *uploadProgress
+// does nothing, so callers don't need to check whether progress is wanted.
+type uploadProgress struct {
+	report func(UploadProgress)
+	state  UploadProgress
+	last   int64
+}
+
+// newUploadProgress returns a tracker for r, or nil if report is nil
+func newUploadProgress(r *http.Request, report func(UploadProgress)) *uploadProgress {
+	if report == nil {
+		return nil
+	}
+	return &uploadProgress{
+		report: report,
+		state: UploadProgress{
+			UploadID:      UploadID(r),
+			Stage:         ProgressReceiving,
+			ContentLength: r.ContentLength,
+		},
+	}
+}
+
+// body wraps the request body to count received bytes
+func (p *uploadProgress) body(rc io.ReadCloser) io.ReadCloser {
+	if p == nil {
+		return rc
+	}
+	return &progressReadCloser{ReadCloser: rc, add: func(n int64) {
+		p.state.Received += n
+		p.maybeReport(p.state.Received)
+	}}
+}
+
+// writing switches to the writing stage, once the total size of the files is known
+func (p *uploadProgress) writing(totalSize int64) {
+	if p == nil {
+		return
+	}
+	p.state.Stage = ProgressWriting
+	p.state.TotalSize = totalSize
+	p.last = 0
+	p.report(p.state)
+}
+
+// file wraps the reader of one file to count written bytes
+func (p *uploadProgress) file(r io.Reader, name string, size int64) io.Reader {
+	if p == nil {
+		return r
+	}
+	p.state.File, p.state.FileBytes, p.state.FileSize = name, 0, size
+	return &progressReadCloser{ReadCloser: io.NopCloser(r), add: func(n int64) {
+		p.state.FileBytes += n
+		p.state.Written += n
+		p.maybeReport(p.state.Written)
+	}}
+}
+
+// finish reports the end of the upload
+func (p *uploadProgress) finish(err error) {
+	if p == nil {
+		return
+	}
+	p.state.Stage = ProgressDone
+	if err != nil {
+		p.state.Stage = ProgressFailed
+		p.state.Error = err.Error()
+	}
+	p.report(p.state)
+}
+
+// maybeReport reports the state if enough bytes went by since the last report
+func (p *uploadProgress) maybeReport(n int64) {
+	if n-p.last >= progressInterval {
+		p.last = n
+		p.report(p.state)
+	}
+}
+
+// progressReadCloser calls add with the size of every read
+type progressReadCloser struct {
+	io.ReadCloser
+	add func(n int64)
+}
+
+// Read implements io.Reader
+func (r *progressReadCloser) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	if n > 0 {
+		r.add(int64(n))
+	}
+	return n, err
+}
+
+// progressRetention is how long a finished upload's last progress is kept for late subscribers
+const progressRetention = time.Minute
+
+// ProgressHub collects upload progress and streams it to other connections. Use its
+// Report method as Tools.OnUploadProgress, and serve it to let clients follow an
+// upload by ID with server-sent events. It is safe for concurrent use.
+type ProgressHub struct {
+	// Authorize decides whether the client of r may follow the upload with the given ID.
+	// Upload IDs are chosen by clients, so they can't be trusted to be secret: check that
+	// the upload belongs to the user of r. If Authorize is nil, every subscription is
+	// denied with a 403.
+	Authorize func(r *http.Request, uploadID string) bool
+
+	tools    *Tools
+	mu       sync.Mutex
+	latest   map[string]UploadProgress
+	finished map[string]time.Time
+	subs     map[string]map[chan UploadProgress]struct{}
+}
+
+// NewProgressHub returns an empty ProgressHub, which serves events with the heartbeat,
+// logger and error responses of t
+func (t *Tools) NewProgressHub() *ProgressHub {
+	return &ProgressHub{
+		tools:    t,
+		latest:   make(map[string]UploadProgress),
+		finished: make(map[string]time.Time),
+		subs:     make(map[string]map[chan UploadProgress]struct{}),
+	}
+}
+
+// Report records the progress of an upload and passes it to its subscribers. Uploads
+// without an ID are ignored.
+func (h *ProgressHub) Report(p UploadProgress) {
+	if p.UploadID == "" {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	for id, at := range h.finished {
+		if now.Sub(at) > progressRetention {
+			delete(h.latest, id)
+			delete(h.finished, id)
+		}
+	}
+
+	h.latest[p.UploadID] = p
+	if p.Stage == ProgressDone || p.Stage == ProgressFailed {
+		h.finished[p.UploadID] = now
+	}
+
+	for ch := range h.subs[p.UploadID] {
+		sendLatest(ch, p)
+	}
+}
+
+// sendLatest replaces whatever is waiting in a channel of capacity 1 with p, so slow
+// subscribers skip intermediate updates instead of blocking the upload
+func sendLatest(ch chan UploadProgress, p UploadProgress) {
+	select {
+	case ch <- p:
+	default:
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- p
+	}
+}
+
+// Subscribe returns a channel with the progress of an upload, starting with the latest
+// report if there is one, and a function to unsubscribe
+func (h *ProgressHub) Subscribe(uploadID string) (<-chan UploadProgress, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan UploadProgress, 1)
+	if p, ok := h.latest[uploadID]; ok {
+		ch <- p
+	}
+
+	if h.subs[uploadID] == nil {
+		h.subs[uploadID] = make(map[chan UploadProgress]struct{})
+	}
+	h.subs[uploadID][ch] = struct{}{}
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		delete(h.subs[uploadID], ch)
+		if len(h.subs[uploadID]) == 0 {
+			delete(h.subs, uploadID)
+		}
+	}
+}
+
+// ServeHTTP streams the progress of the upload given by UploadID(r) as server-sent
+// events named "progress", until the upload is done or the client goes away. Clients
+// that h.Authorize doesn't allow get a 403, and a 500 if the response can't be streamed.
+func (h *ProgressHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t := h.tools
+
+	id := UploadID(r)
+	if id == "" {
+		_ = t.ErrorJSON(w, errors.New("upload_id is required"))
+		return
+	}
+	if h.Authorize == nil || !h.Authorize(r, id) {
+		t.requestLogger(r).Warn("upload progress subscription denied", "upload_id", id)
+		_ = t.ErrorJSON(w, errors.New("not allowed to follow this upload"), http.StatusForbidden)
+		return
+	}
+
+	sse, err := t.NewSSEWriter(w)
+	if err != nil {
+		t.requestLogger(r).Error("event stream failed", "error", err)
+		_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	ch, unsubscribe := h.Subscribe(id)
+	defer unsubscribe()
+
+	var heartbeat <-chan time.Time
+	if interval := t.sseHeartbeat(); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat:
+			if err := sse.Comment("heartbeat"); err != nil {
+				return
+			}
+		case p := <-ch:
+			if err := sse.Send(SSEEvent{Event: "progress", Data: p}); err != nil {
+				return
+			}
+			if p.Stage == ProgressDone || p.Stage == ProgressFailed {
+				return
+			}
+		}
+	}
+}
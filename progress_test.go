@@ -0,0 +1,161 @@
+package toolkit
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTools_UploadFilesProgress(t *testing.T) {
+	var reports []UploadProgress
+	testTools := Tools{OnUploadProgress: func(p UploadProgress) { reports = append(reports, p) }}
+
+	request := newUploadRequest(t, nil,
+		testUploadFile{field: "file", name: "one.png", contents: testPNG(t)},
+		testUploadFile{field: "file", name: "two.png", contents: testPNG(t)},
+	)
+	request.Header.Set("X-Upload-ID", "abc")
+
+	files, err := testTools.UploadFiles(request, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reports) < 3 {
+		t.Fatalf("expected several reports, got %d", len(reports))
+	}
+
+	stages := map[string]bool{}
+	for _, p := range reports {
+		stages[p.Stage] = true
+		if p.UploadID != "abc" {
+			t.Errorf("expected upload ID abc, got %q", p.UploadID)
+		}
+	}
+	for _, stage := range []string{ProgressReceiving, ProgressWriting, ProgressDone} {
+		if !stages[stage] {
+			t.Errorf("expected a %s report", stage)
+		}
+	}
+
+	last := reports[len(reports)-1]
+	total := files[0].FileSize + files[1].FileSize
+	if last.Stage != ProgressDone || last.Written != total || last.TotalSize != total {
+		t.Errorf("unexpected final report %+v", last)
+	}
+	if last.Received != request.ContentLength {
+		t.Errorf("expected %d bytes received, got %d", request.ContentLength, last.Received)
+	}
+}
+
+func TestTools_UploadFilesProgressFailed(t *testing.T) {
+	var last UploadProgress
+	testTools := Tools{
+		AllowedFileTypes: []string{"image/jpeg"},
+		OnUploadProgress: func(p UploadProgress) { last = p },
+	}
+
+	request := newUploadRequest(t, nil, testUploadFile{field: "file", name: "one.png", contents: testPNG(t)})
+	if _, err := testTools.UploadFiles(request, t.TempDir()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if last.Stage != ProgressFailed || last.Error == "" {
+		t.Errorf("expected a failed report with an error, got %+v", last)
+	}
+}
+
+func TestProgressHub(t *testing.T) {
+	testTools := Tools{Logger: slog.New(slog.DiscardHandler), SSEHeartbeat: 10 * time.Millisecond}
+	hub := testTools.NewProgressHub()
+	hub.Authorize = func(r *http.Request, uploadID string) bool {
+		return r.Header.Get("X-User") == "ann" && uploadID == "abc"
+	}
+	server := httptest.NewServer(hub)
+	defer server.Close()
+
+	hub.Report(UploadProgress{UploadID: "abc", Stage: ProgressReceiving, Received: 10})
+
+	request, _ := http.NewRequest("GET", server.URL+"?upload_id=abc", nil)
+	request.Header.Set("X-User", "ann")
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("wrong content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	events := make(chan UploadProgress)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				var p UploadProgress
+				_ = json.Unmarshal([]byte(data), &p)
+				events <- p
+			}
+		}
+	}()
+
+	// the latest report is sent straight away
+	select {
+	case p := <-events:
+		if p.Received != 10 {
+			t.Errorf("expected the latest report, got %+v", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+
+	hub.Report(UploadProgress{UploadID: "other", Stage: ProgressDone})
+	hub.Report(UploadProgress{UploadID: "abc", Stage: ProgressDone, Written: 42})
+
+	select {
+	case p := <-events:
+		if p.Stage != ProgressDone || p.Written != 42 {
+			t.Errorf("expected the done report, got %+v", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no done event received")
+	}
+
+	// the stream ends after the upload is done
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("expected the stream to end")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the stream did not end")
+	}
+
+	rr := httptest.NewRecorder()
+	hub.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d without an upload ID, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	// another user can't follow the upload
+	rr = httptest.NewRecorder()
+	other := httptest.NewRequest("GET", "/?upload_id=abc", nil)
+	other.Header.Set("X-User", "bob")
+	hub.ServeHTTP(rr, other)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d for another user, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	// without Authorize nobody can
+	rr = httptest.NewRecorder()
+	testTools.NewProgressHub().ServeHTTP(rr, httptest.NewRequest("GET", "/?upload_id=abc", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d without Authorize, got %d", http.StatusForbidden, rr.Code)
+	}
+}
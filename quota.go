@@ -0,0 +1,288 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// QuotaStore keeps track of the storage used by each quota key, such as a user ID or
+// an upload directory. UploadFiles reserves the size of an upload before writing it and
+// commits what was actually written afterwards, so concurrent uploads for the same key
+// can't exceed the limit between them. Usage goes down with Free when files are deleted
+// or replaced. Implementations must be safe for concurrent use.
+type QuotaStore interface {
+	// Reserve holds n bytes for key, or returns a *QuotaError if they don't fit
+	Reserve(key string, n int64) error
+	// Commit ends a reservation of reserved bytes, of which used were written
+	Commit(key string, reserved, used int64) error
+	// Release ends a reservation without using it
+	Release(key string, reserved int64) error
+	// Free subtracts n bytes from the usage of key, after files are deleted
+	Free(key string, n int64) error
+	// Usage returns the current usage and limit for key
+	Usage(key string) (QuotaUsage, error)
+}
+
+// QuotaUsage is the state of one quota key
+type QuotaUsage struct {
+	Used     int64 `json:"used"`
+	Reserved int64 `json:"reserved"`
+	// Limit is the number of bytes allowed. Zero or less means no limit
+	Limit int64 `json:"limit"`
+}
+
+// QuotaError is returned when a reservation doesn't fit in a quota. Its StatusCode
+// is 413 when the request is larger than the whole quota, and 507 otherwise.
+type QuotaError struct {
+	Key       string
+	Requested int64
+	Used      int64
+	Reserved  int64
+	Limit     int64
+}
+
+// Error implements the error interface
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("upload of %d bytes exceeds the storage quota (%d of %d bytes used)", e.Requested, e.Used+e.Reserved, e.Limit)
+}
+
+// StatusCode returns the HTTP status code to send for the error
+func (e *QuotaError) StatusCode() int {
+	if e.Requested > e.Limit {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusInsufficientStorage
+}
+
+// quotaKey returns the quota key for an upload. By default the upload directory is the key
+func (t *Tools) quotaKey(r *http.Request, uploadDir string) string {
+	if t.QuotaKey != nil {
+		return t.QuotaKey(r, uploadDir)
+	}
+	return filepath.Clean(uploadDir)
+}
+
+// MemoryQuotaStore is a QuotaStore that keeps usage in memory
+type MemoryQuotaStore struct {
+	// DefaultLimit applies to keys without a limit of their own. Zero or less means no limit
+	DefaultLimit int64
+
+	mu     sync.Mutex
+	usage  map[string]*QuotaUsage
+	limits map[string]int64
+}
+
+// NewMemoryQuotaStore returns an empty MemoryQuotaStore
+func NewMemoryQuotaStore(defaultLimit int64) *MemoryQuotaStore {
+	return &MemoryQuotaStore{
+		DefaultLimit: defaultLimit,
+		usage:        make(map[string]*QuotaUsage),
+		limits:       make(map[string]int64),
+	}
+}
+
+// entry returns the usage of key, creating it if needed. The caller must hold s.mu
+func (s *MemoryQuotaStore) entry(key string) *QuotaUsage {
+	if s.usage == nil {
+		s.usage = make(map[string]*QuotaUsage)
+	}
+	u, ok := s.usage[key]
+	if !ok {
+		u = &QuotaUsage{}
+		s.usage[key] = u
+	}
+
+	u.Limit = s.DefaultLimit
+	if limit, ok := s.limits[key]; ok {
+		u.Limit = limit
+	}
+	return u
+}
+
+// Reserve implements QuotaStore
+func (s *MemoryQuotaStore) Reserve(key string, n int64) error {
+	if n < 0 {
+		return errors.New("reservation must not be negative")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.entry(key)
+	if u.Limit > 0 && u.Used+u.Reserved+n > u.Limit {
+		return &QuotaError{Key: key, Requested: n, Used: u.Used, Reserved: u.Reserved, Limit: u.Limit}
+	}
+	u.Reserved += n
+	return nil
+}
+
+// Commit implements QuotaStore
+func (s *MemoryQuotaStore) Commit(key string, reserved, used int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.entry(key)
+	u.Reserved = max(u.Reserved-reserved, 0)
+	u.Used += used
+	return nil
+}
+
+// Release implements QuotaStore
+func (s *MemoryQuotaStore) Release(key string, reserved int64) error {
+	return s.Commit(key, reserved, 0)
+}
+
+// Usage implements QuotaStore
+func (s *MemoryQuotaStore) Usage(key string) (QuotaUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return *s.entry(key), nil
+}
+
+// Free implements QuotaStore
+func (s *MemoryQuotaStore) Free(key string, n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.entry(key)
+	u.Used = max(u.Used-n, 0)
+	return nil
+}
+
+// SetLimit sets the limit of key, overriding DefaultLimit
+func (s *MemoryQuotaStore) SetLimit(key string, limit int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.limits == nil {
+		s.limits = make(map[string]int64)
+	}
+	s.limits[key] = limit
+	return nil
+}
+
+// FileQuotaStore is a QuotaStore that saves usage and limits to a JSON file, so they
+// survive restarts. Reservations are only kept in memory. The file must not be shared
+// between processes.
+type FileQuotaStore struct {
+	path  string
+	mem   *MemoryQuotaStore
+	write sync.Mutex
+}
+
+// fileQuotaEntry is the saved state of one key
+type fileQuotaEntry struct {
+	Used  int64  `json:"used"`
+	Limit *int64 `json:"limit,omitempty"`
+}
+
+// NewFileQuotaStore returns a FileQuotaStore saved at path, loading it if it exists
+func NewFileQuotaStore(path string, defaultLimit int64) (*FileQuotaStore, error) {
+	s := &FileQuotaStore{path: path, mem: NewMemoryQuotaStore(defaultLimit)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries map[string]fileQuotaEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("reading quota file %s: %w", path, err)
+	}
+	for key, e := range entries {
+		s.mem.entry(key).Used = e.Used
+		if e.Limit != nil {
+			s.mem.limits[key] = *e.Limit
+		}
+	}
+	return s, nil
+}
+
+// Reserve implements QuotaStore
+func (s *FileQuotaStore) Reserve(key string, n int64) error {
+	return s.mem.Reserve(key, n)
+}
+
+// Commit implements QuotaStore
+func (s *FileQuotaStore) Commit(key string, reserved, used int64) error {
+	if err := s.mem.Commit(key, reserved, used); err != nil {
+		return err
+	}
+	if used == 0 {
+		return nil
+	}
+	return s.save()
+}
+
+// Release implements QuotaStore
+func (s *FileQuotaStore) Release(key string, reserved int64) error {
+	return s.mem.Release(key, reserved)
+}
+
+// Usage implements QuotaStore
+func (s *FileQuotaStore) Usage(key string) (QuotaUsage, error) {
+	return s.mem.Usage(key)
+}
+
+// Free implements QuotaStore
+func (s *FileQuotaStore) Free(key string, n int64) error {
+	if err := s.mem.Free(key, n); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// SetLimit sets the limit of key, overriding the default limit
+func (s *FileQuotaStore) SetLimit(key string, limit int64) error {
+	if err := s.mem.SetLimit(key, limit); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// save writes the usage and limits to a temporary file and renames it over the old one
+func (s *FileQuotaStore) save() error {
+	s.write.Lock()
+	defer s.write.Unlock()
+
+	s.mem.mu.Lock()
+	entries := make(map[string]fileQuotaEntry, len(s.mem.usage))
+	for key, u := range s.mem.usage {
+		entries[key] = fileQuotaEntry{Used: u.Used}
+	}
+	for key, limit := range s.mem.limits {
+		e := entries[key]
+		e.Limit = &limit
+		entries[key] = e
+	}
+	s.mem.mu.Unlock()
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,179 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestMemoryQuotaStore(t *testing.T) {
+	store := NewMemoryQuotaStore(100)
+
+	if err := store.Reserve("alice", 60); err != nil {
+		t.Fatal(err)
+	}
+
+	// the reservation counts against the limit
+	err := store.Reserve("alice", 50)
+	var quotaErr *QuotaError
+	if !errors.As(err, &quotaErr) {
+		t.Fatalf("expected a *QuotaError, got %v", err)
+	}
+	if quotaErr.StatusCode() != http.StatusInsufficientStorage {
+		t.Errorf("expected status %d, got %d", http.StatusInsufficientStorage, quotaErr.StatusCode())
+	}
+
+	// a request larger than the whole quota
+	err = store.Reserve("bob", 500)
+	if !errors.As(err, &quotaErr) || quotaErr.StatusCode() != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a 413 quota error, got %v", err)
+	}
+
+	// commit less than was reserved
+	if err := store.Commit("alice", 60, 40); err != nil {
+		t.Fatal(err)
+	}
+	usage, _ := store.Usage("alice")
+	if usage.Used != 40 || usage.Reserved != 0 || usage.Limit != 100 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+
+	if err := store.Reserve("alice", 60); err != nil {
+		t.Errorf("expected the released bytes to be available: %s", err)
+	}
+	_ = store.Release("alice", 60)
+
+	// per key limits and freeing
+	_ = store.SetLimit("alice", 1000)
+	_ = store.Free("alice", 40)
+	usage, _ = store.Usage("alice")
+	if usage.Used != 0 || usage.Limit != 1000 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+}
+
+func TestMemoryQuotaStoreConcurrent(t *testing.T) {
+	store := NewMemoryQuotaStore(1000)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := store.Reserve("alice", 100); err == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if accepted != 10 {
+		t.Errorf("expected 10 reservations to fit, got %d", accepted)
+	}
+}
+
+func TestFileQuotaStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quota.json")
+
+	store, err := NewFileQuotaStore(path, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = store.SetLimit("alice", 500)
+	if err := store.Reserve("alice", 300); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Commit("alice", 300, 250); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewFileQuotaStore(path, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage, _ := reloaded.Usage("alice")
+	if usage.Used != 250 || usage.Limit != 500 || usage.Reserved != 0 {
+		t.Errorf("unexpected usage after reload %+v", usage)
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileQuotaStore(path, 100); err == nil {
+		t.Error("expected an error for a corrupt quota file")
+	}
+}
+
+func TestTools_UploadFilesQuota(t *testing.T) {
+	uploadDir := t.TempDir()
+	store := NewMemoryQuotaStore(0)
+	_ = store.SetLimit("alice", 200000)
+
+	testTools := Tools{
+		QuotaStore: store,
+		QuotaKey:   func(r *http.Request, uploadDir string) string { return r.Header.Get("X-User") },
+	}
+
+	upload := func() ([]*UploadedFile, error) {
+		request := newUploadRequest(t, nil, testUploadFile{field: "file", name: "logo.png", contents: testPNG(t)})
+		request.Header.Set("X-User", "alice")
+		return testTools.UploadFiles(request, uploadDir)
+	}
+
+	files, err := upload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage, _ := store.Usage("alice")
+	if usage.Used != files[0].FileSize || usage.Reserved != 0 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+
+	// a second copy does not fit
+	_, err = upload()
+	var quotaErr *QuotaError
+	if !errors.As(err, &quotaErr) {
+		t.Fatalf("expected a *QuotaError, got %v", err)
+	}
+
+	entries, _ := os.ReadDir(uploadDir)
+	if len(entries) != 1 {
+		t.Errorf("expected the rejected upload not to be written, found %d files", len(entries))
+	}
+}
+
+func TestTools_UploadFilesQuotaFreed(t *testing.T) {
+	uploadDir := t.TempDir()
+	store := NewMemoryQuotaStore(0)
+	testTools := Tools{QuotaStore: store, UploadCollisionPolicy: CollisionOverwrite}
+	key := filepath.Clean(uploadDir)
+
+	// overwriting a file frees the space of the old one
+	for range 2 {
+		request := newUploadRequest(t, nil, testUploadFile{field: "file", name: "logo.png", contents: testPNG(t)})
+		if _, err := testTools.UploadFiles(request, uploadDir, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	usage, _ := store.Usage(key)
+	if usage.Used != int64(len(testPNG(t))) {
+		t.Errorf("expected the usage of one file, got %+v", usage)
+	}
+
+	// and so does deleting it
+	if _, err := testTools.CleanUploads(JanitorConfig{Dir: uploadDir, MaxBytes: 1}); err != nil {
+		t.Fatal(err)
+	}
+	usage, _ = store.Usage(key)
+	if usage.Used != 0 {
+		t.Errorf("expected the janitor to free the quota, got %+v", usage)
+	}
+}
@@ -0,0 +1,117 @@
+package toolkit
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// Alphabets that can be passed to GenerateRandomString
+const (
+	// AlphabetURLSafe is the base64url alphabet, safe in URLs and file names
+	AlphabetURLSafe = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	// AlphabetAlphanumeric contains upper and lower case letters and digits
+	AlphabetAlphanumeric = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	// AlphabetHex contains lower case hexadecimal digits
+	AlphabetHex = "0123456789abcdef"
+	// AlphabetCrockford is Crockford's base32, which leaves out I, L, O and U
+	AlphabetCrockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	// AlphabetUnambiguous leaves out characters that are easily confused, like 0/O and 1/l/I
+	AlphabetUnambiguous = "23456789abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+)
+
+// GenerateRandomString returns a string of n characters picked uniformly from
+// the alphabet using crypto/rand. If no alphabet is given, the one used by
+// RandomString is used. An error is returned if the alphabet is invalid or the
+// system can't provide entropy.
+func (t *Tools) GenerateRandomString(n int, alphabet ...string) (string, error) {
+	source := randomStringSource
+	if len(alphabet) > 0 {
+		source = alphabet[0]
+	}
+
+	if n < 0 {
+		return "", errors.New("length must not be negative")
+	}
+
+	r := []rune(source)
+	if err := validateAlphabet(r); err != nil {
+		return "", err
+	}
+
+	idx, err := randomIndexes(n, len(r))
+	if err != nil {
+		return "", err
+	}
+
+	s := make([]rune, n)
+	for i, x := range idx {
+		s[i] = r[x]
+	}
+	return string(s), nil
+}
+
+// validateAlphabet checks that an alphabet can be sampled without bias
+func validateAlphabet(r []rune) error {
+	if len(r) < 2 {
+		return errors.New("alphabet must have at least two characters")
+	}
+	if len(r) > 256 {
+		return errors.New("alphabet must not have more than 256 characters")
+	}
+
+	seen := make(map[rune]bool, len(r))
+	for _, c := range r {
+		if seen[c] {
+			return fmt.Errorf("alphabet contains duplicate character %q", c)
+		}
+		seen[c] = true
+	}
+	return nil
+}
+
+// randomIndexes returns n uniformly distributed integers in [0, size), with size
+// at most 256. Random bytes are masked to the next power of two and values
+// outside the range are rejected, so no index is more likely than another.
+func randomIndexes(n, size int) ([]int, error) {
+	mask := byte(1<<bits.Len(uint(size-1)) - 1)
+	out := make([]int, 0, n)
+
+	// On average fewer than two bytes are needed per index, so read a bit more than n at a time
+	buf := make([]byte, n+n/2+8)
+	for len(out) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("reading random bytes: %w", err)
+		}
+		for _, b := range buf {
+			if x := int(b & mask); x < size {
+				out = append(out, x)
+				if len(out) == n {
+					break
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// randomInt returns a uniformly distributed integer in [0, max)
+func randomInt(max int) (int, error) {
+	if max <= 0 {
+		return 0, errors.New("max must be positive")
+	}
+
+	// Reject the top part of the range that would make small values more likely
+	limit := ^uint64(0) - ^uint64(0)%uint64(max)
+	var b [8]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			return 0, fmt.Errorf("reading random bytes: %w", err)
+		}
+		if v := binary.BigEndian.Uint64(b[:]); v < limit {
+			return int(v % uint64(max)), nil
+		}
+	}
+}
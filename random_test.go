@@ -0,0 +1,82 @@
+package toolkit
+
+import (
+	"strings"
+	"testing"
+)
+
+var randomStringTests = []struct {
+	name          string
+	length        int
+	alphabet      string
+	errorExpected bool
+}{
+	{name: "url safe", length: 32, alphabet: AlphabetURLSafe, errorExpected: false},
+	{name: "alphanumeric", length: 32, alphabet: AlphabetAlphanumeric, errorExpected: false},
+	{name: "hex", length: 32, alphabet: AlphabetHex, errorExpected: false},
+	{name: "crockford", length: 26, alphabet: AlphabetCrockford, errorExpected: false},
+	{name: "unambiguous", length: 20, alphabet: AlphabetUnambiguous, errorExpected: false},
+	{name: "non ascii", length: 10, alphabet: "áéíóú", errorExpected: false},
+	{name: "zero length", length: 0, alphabet: AlphabetHex, errorExpected: false},
+	{name: "negative length", length: -1, alphabet: AlphabetHex, errorExpected: true},
+	{name: "single character", length: 10, alphabet: "a", errorExpected: true},
+	{name: "duplicate characters", length: 10, alphabet: "abca", errorExpected: true},
+}
+
+func TestTools_GenerateRandomString(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range randomStringTests {
+		s, err := testTools.GenerateRandomString(e.length, e.alphabet)
+
+		if e.errorExpected && err == nil {
+			t.Errorf("%s: error expected but got none", e.name)
+		}
+		if !e.errorExpected && err != nil {
+			t.Errorf("%s: error not expected but got one: %s", e.name, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		if len([]rune(s)) != e.length {
+			t.Errorf("%s: expected length %d, got %d", e.name, e.length, len([]rune(s)))
+		}
+		for _, c := range s {
+			if !strings.ContainsRune(e.alphabet, c) {
+				t.Errorf("%s: character %q is not in the alphabet", e.name, c)
+			}
+		}
+	}
+}
+
+func TestTools_GenerateRandomStringDistribution(t *testing.T) {
+	var testTools Tools
+
+	// 36 characters means 28 of every 64 masked values are rejected; a biased
+	// sampler would favour the first characters of the alphabet
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	const samples = 36 * 2000
+
+	s, err := testTools.GenerateRandomString(samples, alphabet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[rune]int)
+	for _, c := range s {
+		counts[c]++
+	}
+
+	expected := float64(samples) / float64(len(alphabet))
+	var chi2 float64
+	for _, c := range alphabet {
+		d := float64(counts[c]) - expected
+		chi2 += d * d / expected
+	}
+
+	// 35 degrees of freedom; 80 is far beyond the 99.99th percentile
+	if chi2 > 80 {
+		t.Errorf("distribution looks biased, chi-squared is %.1f", chi2)
+	}
+}
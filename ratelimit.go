@@ -0,0 +1,353 @@
+package toolkit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitAlgorithm is the way a RateLimiter counts requests
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket lets a client spend up to Burst requests at once, and refills its
+	// bucket at Limit requests per Window
+	TokenBucket RateLimitAlgorithm = iota
+	// SlidingWindow allows Limit requests in any Window, weighing the previous window by
+	// how much of it still overlaps the sliding one
+	SlidingWindow
+)
+
+// RateLimitPolicy is the limit a RateLimitStore applies to a key
+type RateLimitPolicy struct {
+	Algorithm RateLimitAlgorithm
+	Limit     int
+	Window    time.Duration
+	// Burst is the size of the bucket for TokenBucket. Defaults to Limit
+	Burst int
+}
+
+// RateLimitResult is the outcome of a request against a rate limit
+type RateLimitResult struct {
+	Allowed bool
+	Limit   int
+	// Remaining is the number of requests the client can still make right away
+	Remaining int
+	// Reset is the time until the client's quota is fully restored
+	Reset time.Duration
+	// RetryAfter is the time until the next request would be allowed, when this one isn't
+	RetryAfter time.Duration
+}
+
+// RateLimitStore counts the requests of each key. Stores shared between instances,
+// such as one backed by Redis, must take a request atomically. Implementations must be
+// safe for concurrent use.
+type RateLimitStore interface {
+	// Take counts one request for key under policy, and reports whether it is allowed
+	Take(ctx context.Context, key string, policy RateLimitPolicy) (RateLimitResult, error)
+}
+
+// RateLimiter configures the RateLimit middleware. Share one between the routes that
+// count against the same limit.
+type RateLimiter struct {
+	Algorithm RateLimitAlgorithm
+	// Limit is the number of requests allowed per Window
+	Limit  int
+	Window time.Duration
+	// Burst is the size of the bucket for TokenBucket. Defaults to Limit
+	Burst int
+	// Key identifies the client of a request. Defaults to RateLimitByIP()
+	Key func(r *http.Request) string
+	// Store counts requests. Defaults to a MemoryRateLimitStore
+	Store RateLimitStore
+
+	once  sync.Once
+	store RateLimitStore
+}
+
+// RateLimitByIP returns a key function that uses the client IP of a request, as found by
+// ClientIP with the given trusted proxies
+func RateLimitByIP(trustedProxies ...netip.Prefix) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		return ClientIP(r, trustedProxies...)
+	}
+}
+
+// RateLimitByHeader returns a key function that uses a header, such as an API key.
+// Requests without the header are keyed by their client IP instead.
+func RateLimitByHeader(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if v := r.Header.Get(name); v != "" {
+			return "header:" + v
+		}
+		return ClientIP(r)
+	}
+}
+
+// ClientIP returns the IP address of the client of r. The X-Forwarded-For header is only
+// believed when the request comes from a trusted proxy, and then read from the right,
+// skipping the addresses of trusted proxies, so clients can't pick their own IP.
+func ClientIP(r *http.Request, trustedProxies ...netip.Prefix) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+
+	trusted := func(s string) bool {
+		addr, err := netip.ParseAddr(strings.TrimSpace(s))
+		if err != nil {
+			return false
+		}
+		addr = addr.Unmap()
+		for _, prefix := range trustedProxies {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+	if !trusted(remote) {
+		return remote
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !trusted(hop) {
+			if addr, err := netip.ParseAddr(hop); err == nil {
+				return addr.Unmap().String()
+			}
+			// Not an address: whatever is to its left can't be trusted either
+			return remote
+		}
+		remote = hop
+	}
+	return remote
+}
+
+// RateLimit returns middleware that limits the requests of each client. Requests over
+// the limit get a 429 written with ErrorJSON and a Retry-After header, and every response
+// gets the RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy headers.
+// If the store fails, the error is logged and the request is let through. It panics if the
+// limit or window isn't positive, the burst is negative or the algorithm is unknown.
+func (t *Tools) RateLimit(l *RateLimiter) func(http.Handler) http.Handler {
+	if l.Limit <= 0 || l.Window <= 0 || l.Burst < 0 {
+		panic(fmt.Sprintf("toolkit: rate limit needs a positive limit and window, got %d per %s with a burst of %d", l.Limit, l.Window, l.Burst))
+	}
+	if l.Algorithm != TokenBucket && l.Algorithm != SlidingWindow {
+		panic(fmt.Sprintf("toolkit: unknown rate limit algorithm %d", l.Algorithm))
+	}
+
+	l.once.Do(func() {
+		l.store = l.Store
+		if l.store == nil {
+			l.store = NewMemoryRateLimitStore()
+		}
+		if l.Key == nil {
+			l.Key = RateLimitByIP()
+		}
+	})
+
+	policy := RateLimitPolicy{Algorithm: l.Algorithm, Limit: l.Limit, Window: l.Window, Burst: l.Burst}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := l.store.Take(r.Context(), l.Key(r), policy)
+			if err != nil {
+				t.requestLogger(r).Error("rate limit store failed", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("RateLimit-Reset", ceilSeconds(result.Reset))
+			header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", policy.Limit, ceilSeconds(policy.Window)))
+
+			if !result.Allowed {
+				header.Set("Retry-After", ceilSeconds(result.RetryAfter))
+				_ = t.ErrorJSON(w, fmt.Errorf("rate limit exceeded, retry in %s seconds", ceilSeconds(result.RetryAfter)), http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ceilSeconds formats d as a whole number of seconds, rounded up
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// MemoryRateLimitStore is a RateLimitStore that keeps counts in memory, for a single instance
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	entries   map[string]*rateLimitEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// rateLimitEntry is the state of one key
+type rateLimitEntry struct {
+	// tokens and updated are the state of a token bucket
+	tokens  float64
+	updated time.Time
+
+	// windowStart, previous and current are the state of a sliding window
+	windowStart time.Time
+	previous    int
+	current     int
+
+	// expires is when the entry is back to its initial state and can be forgotten
+	expires time.Time
+}
+
+// NewMemoryRateLimitStore returns an empty MemoryRateLimitStore
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{entries: make(map[string]*rateLimitEntry), now: time.Now}
+}
+
+// Take implements RateLimitStore
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, policy RateLimitPolicy) (RateLimitResult, error) {
+	if policy.Limit <= 0 || policy.Window <= 0 {
+		return RateLimitResult{}, fmt.Errorf("rate limit needs a positive limit and window, got %d per %s", policy.Limit, policy.Window)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now, policy.Window)
+
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &rateLimitEntry{}
+		s.entries[key] = entry
+	}
+
+	switch policy.Algorithm {
+	case TokenBucket:
+		return entry.takeToken(now, policy), nil
+	case SlidingWindow:
+		return entry.takeWindow(now, policy), nil
+	default:
+		return RateLimitResult{}, fmt.Errorf("unknown rate limit algorithm %d", policy.Algorithm)
+	}
+}
+
+// sweep forgets the entries that have expired, at most once per window
+func (s *MemoryRateLimitStore) sweep(now time.Time, window time.Duration) {
+	if now.Sub(s.lastSweep) < window {
+		return
+	}
+	s.lastSweep = now
+	for key, entry := range s.entries {
+		if now.After(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// takeToken takes a token from the bucket of the entry
+func (e *rateLimitEntry) takeToken(now time.Time, policy RateLimitPolicy) RateLimitResult {
+	burst := policy.Burst
+	if burst <= 0 {
+		burst = policy.Limit
+	}
+	rate := float64(policy.Limit) / policy.Window.Seconds() // tokens per second
+
+	if e.updated.IsZero() {
+		e.tokens = float64(burst)
+	} else {
+		e.tokens = math.Min(float64(burst), e.tokens+now.Sub(e.updated).Seconds()*rate)
+	}
+	e.updated = now
+
+	result := RateLimitResult{Limit: burst}
+	if e.tokens >= 1 {
+		e.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsDuration((1 - e.tokens) / rate)
+	}
+	result.Remaining = int(e.tokens)
+	result.Reset = secondsDuration((float64(burst) - e.tokens) / rate)
+	e.expires = now.Add(result.Reset)
+	return result
+}
+
+// takeWindow counts a request in the sliding window of the entry
+func (e *rateLimitEntry) takeWindow(now time.Time, policy RateLimitPolicy) RateLimitResult {
+	window := policy.Window
+	limit := policy.Limit
+
+	// Move the fixed windows along, so the current one holds now
+	if e.windowStart.IsZero() {
+		e.windowStart = now.Truncate(window)
+	}
+	if elapsed := now.Sub(e.windowStart); elapsed >= window {
+		windows := elapsed / window
+		if windows == 1 {
+			e.previous = e.current
+		} else {
+			e.previous = 0
+		}
+		e.current = 0
+		e.windowStart = e.windowStart.Add(windows * window)
+	}
+
+	elapsed := now.Sub(e.windowStart)
+	overlap := 1 - float64(elapsed)/float64(window)
+	estimate := func() float64 { return float64(e.previous)*overlap + float64(e.current) }
+
+	result := RateLimitResult{Limit: limit, Reset: window - elapsed}
+	if estimate()+1 <= float64(limit) {
+		e.current++
+		result.Allowed = true
+	} else {
+		result.RetryAfter = e.windowRetryAfter(elapsed, window, limit)
+	}
+	result.Remaining = max(limit-int(math.Ceil(estimate())), 0)
+	e.expires = e.windowStart.Add(2 * window)
+	return result
+}
+
+// windowRetryAfter returns the time until the weighted count of the sliding window drops
+// enough for one more request
+func (e *rateLimitEntry) windowRetryAfter(elapsed, window time.Duration, limit int) time.Duration {
+	free := float64(limit - 1)
+
+	// Later in this window, if the previous one's weight drops enough
+	if e.previous > 0 && float64(e.current) <= free {
+		at := time.Duration(float64(window) * (1 - (free-float64(e.current))/float64(e.previous)))
+		if at > elapsed {
+			return at - elapsed
+		}
+	}
+
+	// In the next window, the current one becomes the previous one
+	if e.current == 0 {
+		return window - elapsed
+	}
+	at := time.Duration(float64(window) * (1 - free/float64(e.current)))
+	return window - elapsed + max(at, 0)
+}
+
+// secondsDuration converts seconds to a duration
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,187 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+var clientIPTests = []struct {
+	name         string
+	remoteAddr   string
+	forwardedFor []string
+	trusted      []netip.Prefix
+	expectedIP   string
+}{
+	{name: "remote address", remoteAddr: "203.0.113.7:4321", expectedIP: "203.0.113.7"},
+	{name: "untrusted proxy", remoteAddr: "203.0.113.7:4321", forwardedFor: []string{"198.51.100.1"}, expectedIP: "203.0.113.7"},
+	{name: "trusted proxy", remoteAddr: "10.0.0.2:4321", forwardedFor: []string{"198.51.100.1"}, trusted: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, expectedIP: "198.51.100.1"},
+	{name: "spoofed hop", remoteAddr: "10.0.0.2:4321", forwardedFor: []string{"1.2.3.4, 198.51.100.1, 10.0.0.3"}, trusted: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, expectedIP: "198.51.100.1"},
+	{name: "several headers", remoteAddr: "10.0.0.2:4321", forwardedFor: []string{"1.2.3.4", "198.51.100.1"}, trusted: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, expectedIP: "198.51.100.1"},
+	{name: "garbage hop", remoteAddr: "10.0.0.2:4321", forwardedFor: []string{"1.2.3.4, nonsense"}, trusted: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, expectedIP: "10.0.0.2"},
+	{name: "ipv6", remoteAddr: "[2001:db8::1]:4321", expectedIP: "2001:db8::1"},
+}
+
+func TestClientIP(t *testing.T) {
+	for _, e := range clientIPTests {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.RemoteAddr = e.remoteAddr
+		for _, v := range e.forwardedFor {
+			request.Header.Add("X-Forwarded-For", v)
+		}
+
+		if ip := ClientIP(request, e.trusted...); ip != e.expectedIP {
+			t.Errorf("%s: expected %s, got %s", e.name, e.expectedIP, ip)
+		}
+	}
+}
+
+// takeAt takes a request from store for key at a point in time
+func takeAt(t *testing.T, store *MemoryRateLimitStore, at time.Time, policy RateLimitPolicy) RateLimitResult {
+	t.Helper()
+
+	store.now = func() time.Time { return at }
+	result, err := store.Take(context.Background(), "client", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestMemoryRateLimitStore_TokenBucket(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	policy := RateLimitPolicy{Algorithm: TokenBucket, Limit: 2, Window: time.Second, Burst: 3}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// the burst goes through at once
+	for i := range 3 {
+		if result := takeAt(t, store, start, policy); !result.Allowed || result.Remaining != 2-i {
+			t.Fatalf("request %d: unexpected result %+v", i, result)
+		}
+	}
+	result := takeAt(t, store, start, policy)
+	if result.Allowed || result.RetryAfter != 500*time.Millisecond || result.Reset != 1500*time.Millisecond {
+		t.Errorf("expected a rejection with a 500ms retry, got %+v", result)
+	}
+
+	// then tokens come back at 2 per second
+	if result := takeAt(t, store, start.Add(500*time.Millisecond), policy); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("expected a refilled token, got %+v", result)
+	}
+	if result := takeAt(t, store, start.Add(time.Hour), policy); !result.Allowed || result.Remaining != 2 {
+		t.Errorf("expected a full bucket after an hour, got %+v", result)
+	}
+}
+
+func TestMemoryRateLimitStore_SlidingWindow(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	policy := RateLimitPolicy{Algorithm: SlidingWindow, Limit: 4, Window: time.Minute}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := range 4 {
+		if result := takeAt(t, store, start.Add(50*time.Second), policy); !result.Allowed || result.Remaining != 3-i {
+			t.Fatalf("request %d: unexpected result %+v", i, result)
+		}
+	}
+	result := takeAt(t, store, start.Add(50*time.Second), policy)
+	if result.Allowed || result.RetryAfter != 25*time.Second {
+		t.Errorf("expected a rejection until 1/4 of the window has passed, got %+v", result)
+	}
+
+	// 15s into the next window, the previous one still weighs 3 requests
+	if result := takeAt(t, store, start.Add(75*time.Second), policy); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("expected one request to be allowed, got %+v", result)
+	}
+	if result := takeAt(t, store, start.Add(75*time.Second), policy); result.Allowed {
+		t.Errorf("expected the weighted window to be full, got %+v", result)
+	}
+
+	// after two windows everything is forgotten
+	if result := takeAt(t, store, start.Add(3*time.Minute), policy); !result.Allowed || result.Remaining != 3 {
+		t.Errorf("expected an empty window, got %+v", result)
+	}
+	if len(store.entries) != 1 {
+		t.Errorf("expected one entry, got %d", len(store.entries))
+	}
+}
+
+// failingRateLimitStore is a RateLimitStore that is always down
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(context.Context, string, RateLimitPolicy) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("store is down")
+}
+
+func TestTools_RateLimit(t *testing.T) {
+	testTools := Tools{Logger: slog.New(slog.DiscardHandler)}
+	limiter := &RateLimiter{Algorithm: TokenBucket, Limit: 1, Window: time.Minute, Key: RateLimitByHeader("X-API-Key")}
+	handler := testTools.RateLimit(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(key string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("X-API-Key", key)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, request)
+		return rr
+	}
+
+	rr := serve("alice")
+	if rr.Code != http.StatusNoContent || rr.Header().Get("RateLimit-Remaining") != "0" || rr.Header().Get("RateLimit-Policy") != "1;w=60" {
+		t.Errorf("unexpected first response %d %v", rr.Code, rr.Header())
+	}
+
+	rr = serve("alice")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "60" || rr.Header().Get("RateLimit-Limit") != "1" {
+		t.Errorf("unexpected rejection %d %v", rr.Code, rr.Header())
+	}
+	var payload JSONResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil || !payload.Error {
+		t.Errorf("expected a JSON error, got %s", rr.Body.String())
+	}
+
+	// other keys have their own limit
+	if rr := serve("bob"); rr.Code != http.StatusNoContent {
+		t.Errorf("expected another key to be allowed, got %d", rr.Code)
+	}
+
+	// a failing store lets requests through
+	handler = testTools.RateLimit(&RateLimiter{Limit: 1, Window: time.Minute, Store: failingRateLimitStore{}})(handler)
+	if rr := serve("carol"); rr.Code != http.StatusNoContent {
+		t.Errorf("expected a failing store to let the request through, got %d", rr.Code)
+	}
+}
+
+var rateLimitConfigTests = []struct {
+	name          string
+	limiter       *RateLimiter
+	panicExpected bool
+}{
+	{name: "valid", limiter: &RateLimiter{Algorithm: SlidingWindow, Limit: 10, Window: time.Second}},
+	{name: "no limit", limiter: &RateLimiter{Window: time.Second}, panicExpected: true},
+	{name: "no window", limiter: &RateLimiter{Limit: 10}, panicExpected: true},
+	{name: "negative burst", limiter: &RateLimiter{Limit: 10, Window: time.Second, Burst: -1}, panicExpected: true},
+	{name: "unknown algorithm", limiter: &RateLimiter{Algorithm: 7, Limit: 10, Window: time.Second}, panicExpected: true},
+}
+
+func TestTools_RateLimitConfig(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range rateLimitConfigTests {
+		panicked := func() (panicked bool) {
+			defer func() { panicked = recover() != nil }()
+			testTools.RateLimit(e.limiter)
+			return false
+		}()
+		if panicked != e.panicExpected {
+			t.Errorf("%s: expected a panic: %v, got %v", e.name, e.panicExpected, panicked)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+)
+
+// RPCError is a JSON-RPC error. Return one from a method to choose the code sent to the
+// client; other errors are sent as internal errors. The client returns one when a call fails.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// Error implements the error interface
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// rpcRequest is the envelope of a request. A request without an ID is a notification
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// rpcResponse is the envelope of a response. Result is always set when Error isn't,
+// even if it is null
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// rpcNullID is the ID of responses to requests whose ID couldn't be read
+var rpcNullID = json.RawMessage("null")
+
+// rpcMethod decodes the params of a request and calls the registered function
+type rpcMethod func(ctx context.Context, params json.RawMessage) (any, error)
+
+// RPCServer is an http.Handler that serves JSON-RPC 2.0 requests, batches and
+// notifications over HTTP POST. Register methods with RegisterRPC.
+type RPCServer struct {
+	tools *Tools
+
+	mu      sync.RWMutex
+	methods map[string]rpcMethod
+}
+
+// NewRPCServer returns a server without methods. Request bodies are read with t.ReadJSON
+// and responses written with t.WriteJSON.
+func (t *Tools) NewRPCServer() *RPCServer {
+	return &RPCServer{tools: t, methods: make(map[string]rpcMethod)}
+}
+
+// RegisterRPC registers fn as the method called name. The params of a request are decoded
+// into P, so use a struct for named params or a slice or array for positional ones.
+// Params that don't decode get an invalid params error.
+func RegisterRPC[P, R any](s *RPCServer, name string, fn func(ctx context.Context, params P) (R, error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.methods[name] = func(ctx context.Context, raw json.RawMessage) (any, error) {
+		var params P
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &params); err != nil {
+				return nil, &RPCError{Code: RPCInvalidParams, Message: "Invalid params", Data: err.Error()}
+			}
+		}
+		return fn(ctx, params)
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (s *RPCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		_ = s.tools.ErrorJSON(w, errors.New("JSON-RPC requests must use POST"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body json.RawMessage
+	if err := s.tools.ReadJSON(w, r, &body); err != nil {
+		_ = s.tools.WriteJSON(w, http.StatusOK, rpcErrorResponse(rpcNullID, RPCParseError, "Parse error", err.Error()))
+		return
+	}
+
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '[' {
+		resp := s.handle(r.Context(), body)
+		if resp == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_ = s.tools.WriteJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil || len(batch) == 0 {
+		_ = s.tools.WriteJSON(w, http.StatusOK, rpcErrorResponse(rpcNullID, RPCInvalidRequest, "Invalid Request", nil))
+		return
+	}
+
+	responses := []*rpcResponse{}
+	for _, raw := range batch {
+		if resp := s.handle(r.Context(), raw); resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+
+	// A batch of notifications gets no response at all
+	if len(responses) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	_ = s.tools.WriteJSON(w, http.StatusOK, responses)
+}
+
+// handle runs one request, and returns its response or nil for a notification
+func (s *RPCServer) handle(ctx context.Context, raw json.RawMessage) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil || req.JSONRPC != "2.0" || req.Method == "" {
+		return rpcErrorResponse(rpcNullID, RPCInvalidRequest, "Invalid Request", nil)
+	}
+
+	if req.ID != nil && !validRPCID(req.ID) {
+		return rpcErrorResponse(rpcNullID, RPCInvalidRequest, "Invalid Request", "id must be a string, a number or null")
+	}
+
+	s.mu.RLock()
+	method, ok := s.methods[req.Method]
+	s.mu.RUnlock()
+
+	var result any
+	var err error
+	if ok {
+		result, err = callRPCMethod(ctx, method, req.Params)
+	} else {
+		err = &RPCError{Code: RPCMethodNotFound, Message: "Method not found"}
+	}
+
+	if req.ID == nil {
+		return nil
+	}
+
+	if err != nil {
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &RPCError{Code: RPCInternalError, Message: err.Error()}
+		}
+		return &rpcResponse{JSONRPC: "2.0", Error: rpcErr, ID: req.ID}
+	}
+
+	out, err := json.Marshal(result)
+	if err != nil {
+		return rpcErrorResponse(req.ID, RPCInternalError, "Internal error", err.Error())
+	}
+	return &rpcResponse{JSONRPC: "2.0", Result: out, ID: req.ID}
+}
+
+// callRPCMethod calls a method, turning a panic into an internal error
+func callRPCMethod(ctx context.Context, method rpcMethod, params json.RawMessage) (result any, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &RPCError{Code: RPCInternalError, Message: "Internal error", Data: fmt.Sprint(v)}
+		}
+	}()
+	return method(ctx, params)
+}
+
+// rpcErrorResponse returns an error response
+func rpcErrorResponse(id json.RawMessage, code int, message string, data any) *rpcResponse {
+	return &rpcResponse{JSONRPC: "2.0", Error: &RPCError{Code: code, Message: message, Data: data}, ID: id}
+}
+
+// validRPCID reports whether a request ID is a string, a number or null
+func validRPCID(id json.RawMessage) bool {
+	var v any
+	if err := json.Unmarshal(id, &v); err != nil {
+		return false
+	}
+	switch v.(type) {
+	case string, float64, nil:
+		return true
+	}
+	return false
+}
+
+// RPCClient calls the methods of a JSON-RPC 2.0 server over HTTP. It is safe for concurrent use.
+type RPCClient struct {
+	tools  *Tools
+	url    string
+	client *http.Client
+	nextID atomic.Int64
+}
+
+// NewRPCClient returns a client for the server at url, using the same transport as
+// PushJSONToRemote. An optional *http.Client replaces the default one.
+func (t *Tools) NewRPCClient(url string, client ...*http.Client) *RPCClient {
+	c := &RPCClient{tools: t, url: url, client: &http.Client{}}
+	if len(client) > 0 {
+		c.client = client[0]
+	}
+	return c
+}
+
+// RPCCall is one call of a batch. After Batch returns, Err is set if the call failed,
+// and Result holds the result otherwise. Notifications get neither.
+type RPCCall struct {
+	Method string
+	Params any
+	// Result is a pointer the result is decoded into. It may be nil
+	Result any
+	// Notify sends the call as a notification, without waiting for a result
+	Notify bool
+	Err    error
+}
+
+// Call calls a method and decodes its result into result, which may be nil. A failed
+// call returns an *RPCError.
+func (c *RPCClient) Call(ctx context.Context, method string, params, result any) error {
+	call := &RPCCall{Method: method, Params: params, Result: result}
+	if err := c.Batch(ctx, call); err != nil {
+		return err
+	}
+	return call.Err
+}
+
+// Notify calls a method without waiting for a result
+func (c *RPCClient) Notify(ctx context.Context, method string, params any) error {
+	return c.Batch(ctx, &RPCCall{Method: method, Params: params, Notify: true})
+}
+
+// Batch sends several calls in one request. The returned error is for the whole
+// request; the error of each call is in its Err field. A single call is sent on its own.
+func (c *RPCClient) Batch(ctx context.Context, calls ...*RPCCall) error {
+	if len(calls) == 0 {
+		return errors.New("rpc batch must not be empty")
+	}
+
+	requests := make([]rpcRequest, len(calls))
+	pending := make(map[string]*RPCCall)
+	for i, call := range calls {
+		call.Err = nil
+		requests[i] = rpcRequest{JSONRPC: "2.0", Method: call.Method}
+
+		if call.Params != nil {
+			params, err := json.Marshal(call.Params)
+			if err != nil {
+				return err
+			}
+			requests[i].Params = params
+		}
+		if !call.Notify {
+			id := strconv.FormatInt(c.nextID.Add(1), 10)
+			requests[i].ID = json.RawMessage(id)
+			pending[id] = call
+		}
+	}
+
+	var payload any = requests
+	if len(requests) == 1 {
+		payload = requests[0]
+	}
+
+	resp, err := c.tools.pushJSON(ctx, c.url, payload, c.client)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) == 0 {
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("rpc: unexpected status %d", resp.StatusCode)
+		}
+		return nil
+	}
+
+	var responses []rpcResponse
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		err = json.Unmarshal(body, &responses)
+	} else {
+		var single rpcResponse
+		err = json.Unmarshal(body, &single)
+		responses = append(responses, single)
+	}
+	if err != nil {
+		return fmt.Errorf("rpc: unexpected response with status %d: %w", resp.StatusCode, err)
+	}
+
+	// An error without an ID is about a request the server couldn't read, such as a parse error
+	var requestErr error
+	for _, r := range responses {
+		call, ok := pending[string(r.ID)]
+		if !ok {
+			if r.Error != nil {
+				requestErr = r.Error
+			}
+			continue
+		}
+		delete(pending, string(r.ID))
+
+		switch {
+		case r.Error != nil:
+			call.Err = r.Error
+		case call.Result != nil:
+			call.Err = json.Unmarshal(r.Result, call.Result)
+		}
+	}
+
+	for id, call := range pending {
+		call.Err = requestErr
+		if call.Err == nil {
+			call.Err = fmt.Errorf("rpc: no response for call %s to %s", id, call.Method)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestRPCServer returns a server with an add method taking named params, a sum method
+// taking positional ones, a method that fails, and a method that counts its calls
+func newTestRPCServer(t *testing.T, calls *atomic.Int64) *RPCServer {
+	t.Helper()
+
+	var testTools Tools
+	server := testTools.NewRPCServer()
+
+	type addParams struct {
+		A int `json:"a"`
+		B int `json:"b"`
+	}
+	RegisterRPC(server, "add", func(ctx context.Context, p addParams) (int, error) {
+		return p.A + p.B, nil
+	})
+	RegisterRPC(server, "sum", func(ctx context.Context, p []int) (int, error) {
+		total := 0
+		for _, n := range p {
+			total += n
+		}
+		return total, nil
+	})
+	RegisterRPC(server, "fail", func(ctx context.Context, p struct{}) (any, error) {
+		return nil, &RPCError{Code: 42, Message: "it failed"}
+	})
+	RegisterRPC(server, "count", func(ctx context.Context, p struct{}) (any, error) {
+		calls.Add(1)
+		return nil, nil
+	})
+	return server
+}
+
+var rpcServerTests = []struct {
+	name           string
+	body           string
+	expectedStatus int
+	expected       string
+}{
+	{name: "named params", body: `{"jsonrpc":"2.0","method":"add","params":{"a":1,"b":2},"id":1}`, expectedStatus: http.StatusOK, expected: `{"jsonrpc":"2.0","result":3,"id":1}`},
+	{name: "positional params", body: `{"jsonrpc":"2.0","method":"sum","params":[1,2,3],"id":"x"}`, expectedStatus: http.StatusOK, expected: `{"jsonrpc":"2.0","result":6,"id":"x"}`},
+	{name: "null result", body: `{"jsonrpc":"2.0","method":"count","id":2}`, expectedStatus: http.StatusOK, expected: `{"jsonrpc":"2.0","result":null,"id":2}`},
+	{name: "notification", body: `{"jsonrpc":"2.0","method":"count"}`, expectedStatus: http.StatusNoContent},
+	{name: "method error", body: `{"jsonrpc":"2.0","method":"fail","id":3}`, expectedStatus: http.StatusOK, expected: `{"jsonrpc":"2.0","error":{"code":42,"message":"it failed"},"id":3}`},
+	{name: "method not found", body: `{"jsonrpc":"2.0","method":"nope","id":4}`, expectedStatus: http.StatusOK, expected: `{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":4}`},
+	{name: "invalid params", body: `{"jsonrpc":"2.0","method":"add","params":[1,2],"id":5}`, expectedStatus: http.StatusOK, expected: `"code":-32602`},
+	{name: "parse error", body: `{"jsonrpc":"2.0","method"`, expectedStatus: http.StatusOK, expected: `"code":-32700`},
+	{name: "wrong version", body: `{"jsonrpc":"1.0","method":"add","id":6}`, expectedStatus: http.StatusOK, expected: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`},
+	{name: "invalid id", body: `{"jsonrpc":"2.0","method":"add","id":{}}`, expectedStatus: http.StatusOK, expected: `"code":-32600`},
+	{name: "empty batch", body: `[]`, expectedStatus: http.StatusOK, expected: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`},
+	{name: "batch", body: `[{"jsonrpc":"2.0","method":"add","params":{"a":1,"b":1},"id":1},{"jsonrpc":"2.0","method":"count"},1]`, expectedStatus: http.StatusOK, expected: `[{"jsonrpc":"2.0","result":2,"id":1},{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}]`},
+	{name: "batch of notifications", body: `[{"jsonrpc":"2.0","method":"count"},{"jsonrpc":"2.0","method":"nope"}]`, expectedStatus: http.StatusNoContent},
+}
+
+func TestRPCServer(t *testing.T) {
+	var calls atomic.Int64
+	server := newTestRPCServer(t, &calls)
+
+	for _, e := range rpcServerTests {
+		request := httptest.NewRequest("POST", "/", strings.NewReader(e.body))
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, request)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.expectedStatus, rr.Code)
+		}
+		body := strings.TrimSpace(rr.Body.String())
+		if e.expected == "" {
+			if body != "" {
+				t.Errorf("%s: expected no body, got %s", e.name, body)
+			}
+			continue
+		}
+		if strings.HasPrefix(e.expected, "\"") && !strings.Contains(body, e.expected) {
+			t.Errorf("%s: expected %s in %s", e.name, e.expected, body)
+		} else if !strings.HasPrefix(e.expected, "\"") && body != e.expected {
+			t.Errorf("%s: expected %s, got %s", e.name, e.expected, body)
+		}
+	}
+
+	if calls.Load() != 4 {
+		t.Errorf("expected count to be called 4 times, got %d", calls.Load())
+	}
+
+	// only POST is allowed
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d for GET, got %d", http.StatusMethodNotAllowed, rr.Code)
+	}
+}
+
+func TestRPCClient(t *testing.T) {
+	var calls atomic.Int64
+	server := httptest.NewServer(newTestRPCServer(t, &calls))
+	defer server.Close()
+
+	var testTools Tools
+	client := testTools.NewRPCClient(server.URL)
+	ctx := context.Background()
+
+	var sum int
+	if err := client.Call(ctx, "add", map[string]int{"a": 2, "b": 3}, &sum); err != nil {
+		t.Fatal(err)
+	}
+	if sum != 5 {
+		t.Errorf("expected 5, got %d", sum)
+	}
+
+	err := client.Call(ctx, "fail", nil, nil)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != 42 {
+		t.Errorf("expected the method's error, got %v", err)
+	}
+
+	if err := client.Notify(ctx, "count", nil); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected the notification to call count once, got %d", calls.Load())
+	}
+
+	var a, b int
+	batch := []*RPCCall{
+		{Method: "sum", Params: []int{1, 2}, Result: &a},
+		{Method: "count", Notify: true},
+		{Method: "nope"},
+		{Method: "sum", Params: []int{10, 20}, Result: &b},
+	}
+	if err := client.Batch(ctx, batch...); err != nil {
+		t.Fatal(err)
+	}
+	if a != 3 || b != 30 || batch[0].Err != nil || batch[3].Err != nil {
+		t.Errorf("unexpected batch results %d %d %v %v", a, b, batch[0].Err, batch[3].Err)
+	}
+	if !errors.As(batch[2].Err, &rpcErr) || rpcErr.Code != RPCMethodNotFound {
+		t.Errorf("expected method not found, got %v", batch[2].Err)
+	}
+	if batch[1].Err != nil {
+		t.Errorf("unexpected error for a notification %v", batch[1].Err)
+	}
+}
+
+func TestRPCClientRequestError(t *testing.T) {
+	// a server that can't read any request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(rpcErrorResponse(rpcNullID, RPCParseError, "Parse error", nil))
+	}))
+	defer server.Close()
+
+	var testTools Tools
+	err := testTools.NewRPCClient(server.URL).Call(context.Background(), "add", nil, nil)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != RPCParseError {
+		t.Errorf("expected the parse error, got %v", err)
+	}
+}
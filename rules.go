@@ -0,0 +1,135 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// UploadRule describes the files expected in one field of an upload form, for example
+// an avatar that must be a single image of at most 2MB
+type UploadRule struct {
+	// Required means the field must have at least one file
+	Required bool
+	// MinFiles and MaxFiles bound the number of files in the field. Zero means no bound
+	MinFiles int
+	MaxFiles int
+	// MaxFileSize is the largest size of each file, in bytes. Zero means no limit
+	MaxFileSize int64
+	// AllowedFileTypes replaces Tools.AllowedFileTypes for this field
+	AllowedFileTypes []string
+}
+
+// UploadViolation is one broken upload rule
+type UploadViolation struct {
+	Field  string `json:"field"`
+	File   string `json:"file,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// UploadRuleError is returned by UploadFiles when the form breaks the upload rules
+// or contains a file type that isn't allowed. Nothing is written in that case.
+type UploadRuleError struct {
+	Violations []UploadViolation
+}
+
+// Error implements the error interface
+func (e *UploadRuleError) Error() string {
+	reasons := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		reasons[i] = v.Reason
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// StatusCode returns the HTTP status code to send for the error
+func (e *UploadRuleError) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+// validateUpload checks every file of the form against t.UploadRules and the allowed file
+// types, and the total number of files against maxFiles if it's positive, before any file
+// is written. When there are upload rules, files in fields without a rule are rejected.
+func (t *Tools) validateUpload(form *multipart.Form, maxFiles int) error {
+	var violations []UploadViolation
+
+	total := 0
+	for _, field := range slices.Sorted(maps.Keys(form.File)) {
+		files := form.File[field]
+		total += len(files)
+
+		rule, ok := t.UploadRules[field]
+		if !ok && len(t.UploadRules) > 0 {
+			violations = append(violations, UploadViolation{Field: field, Reason: fmt.Sprintf("field %s does not accept files", field)})
+			continue
+		}
+
+		if rule.MaxFiles > 0 && len(files) > rule.MaxFiles {
+			violations = append(violations, UploadViolation{Field: field, Reason: fmt.Sprintf("field %s accepts at most %d files, got %d", field, rule.MaxFiles, len(files))})
+		}
+
+		allowedTypes := t.AllowedFileTypes
+		if len(rule.AllowedFileTypes) > 0 {
+			allowedTypes = rule.AllowedFileTypes
+		}
+
+		for _, hdr := range files {
+			if rule.MaxFileSize > 0 && hdr.Size > rule.MaxFileSize {
+				violations = append(violations, UploadViolation{Field: field, File: hdr.Filename, Reason: fmt.Sprintf("file %s is larger than %d bytes", hdr.Filename, rule.MaxFileSize)})
+			}
+
+			if len(allowedTypes) == 0 {
+				continue
+			}
+			fileType, err := detectFileType(hdr)
+			if err != nil {
+				return err
+			}
+			if !slices.ContainsFunc(allowedTypes, func(x string) bool { return strings.EqualFold(fileType, x) }) {
+				violations = append(violations, UploadViolation{Field: field, File: hdr.Filename, Reason: fmt.Sprintf("file type not allowed: %s", fileType)})
+			}
+		}
+	}
+
+	// Fields that must have files but didn't send any
+	for _, field := range slices.Sorted(maps.Keys(t.UploadRules)) {
+		rule, n := t.UploadRules[field], len(form.File[field])
+		minFiles := rule.MinFiles
+		if rule.Required && minFiles < 1 {
+			minFiles = 1
+		}
+		if n < minFiles {
+			violations = append(violations, UploadViolation{Field: field, Reason: fmt.Sprintf("field %s needs at least %d files, got %d", field, minFiles, n)})
+		}
+	}
+
+	if maxFiles > 0 && total > maxFiles {
+		violations = append(violations, UploadViolation{Reason: fmt.Sprintf("at most %d files can be uploaded at a time, got %d", maxFiles, total)})
+	}
+
+	if len(violations) > 0 {
+		return &UploadRuleError{Violations: violations}
+	}
+	return nil
+}
+
+// detectFileType sniffs the content type of an uploaded file from its first 512 bytes
+func detectFileType(hdr *multipart.FileHeader) (string, error) {
+	f, err := hdr.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buff := make([]byte, 512)
+	n, err := io.ReadFull(f, buff)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return http.DetectContentType(buff[:n]), nil
+}
@@ -0,0 +1,110 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+)
+
+var uploadRulesTests = []struct {
+	name       string
+	rules      map[string]UploadRule
+	files      []testUploadFile
+	violations int
+}{
+	{name: "valid", rules: map[string]UploadRule{
+		"avatar":      {Required: true, MaxFiles: 1, MaxFileSize: 2 << 20, AllowedFileTypes: []string{"image/png", "image/jpeg"}},
+		"attachments": {MaxFiles: 10, AllowedFileTypes: []string{"application/pdf", "image/png"}},
+	}, files: []testUploadFile{{field: "avatar", name: "me.png"}, {field: "attachments", name: "a.png"}}},
+	{name: "missing required field", rules: map[string]UploadRule{
+		"avatar":      {Required: true},
+		"attachments": {},
+	}, files: []testUploadFile{{field: "attachments", name: "a.png"}}, violations: 1},
+	{name: "too few files", rules: map[string]UploadRule{
+		"photos": {MinFiles: 3},
+	}, files: []testUploadFile{{field: "photos", name: "a.png"}, {field: "photos", name: "b.png"}}, violations: 1},
+	{name: "too many files", rules: map[string]UploadRule{
+		"avatar": {MaxFiles: 1},
+	}, files: []testUploadFile{{field: "avatar", name: "a.png"}, {field: "avatar", name: "b.png"}}, violations: 1},
+	{name: "file too large", rules: map[string]UploadRule{
+		"avatar": {MaxFileSize: 100},
+	}, files: []testUploadFile{{field: "avatar", name: "a.png"}}, violations: 1},
+	{name: "type not allowed", rules: map[string]UploadRule{
+		"attachments": {AllowedFileTypes: []string{"application/pdf"}},
+	}, files: []testUploadFile{{field: "attachments", name: "a.png"}, {field: "attachments", name: "b.png"}}, violations: 2},
+	{name: "unknown field", rules: map[string]UploadRule{
+		"avatar": {},
+	}, files: []testUploadFile{{field: "avatar", name: "a.png"}, {field: "other", name: "b.png"}}, violations: 1},
+	{name: "every violation", rules: map[string]UploadRule{
+		"avatar":      {Required: true},
+		"attachments": {MaxFiles: 1, MaxFileSize: 100},
+	}, files: []testUploadFile{{field: "attachments", name: "a.png"}, {field: "attachments", name: "b.png"}}, violations: 4},
+}
+
+func TestTools_UploadRules(t *testing.T) {
+	png := testPNG(t)
+
+	for _, e := range uploadRulesTests {
+		testTools := Tools{UploadRules: e.rules}
+		dir := t.TempDir()
+
+		for i := range e.files {
+			e.files[i].contents = png
+		}
+
+		files, err := testTools.UploadFiles(newUploadRequest(t, nil, e.files...), dir)
+
+		if e.violations == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", e.name, err)
+			}
+			if len(files) != len(e.files) {
+				t.Errorf("%s: expected %d files, got %d", e.name, len(e.files), len(files))
+			}
+			continue
+		}
+
+		var ruleErr *UploadRuleError
+		if !errors.As(err, &ruleErr) {
+			t.Errorf("%s: expected an *UploadRuleError, got %v", e.name, err)
+			continue
+		}
+		if len(ruleErr.Violations) != e.violations {
+			t.Errorf("%s: expected %d violations, got %+v", e.name, e.violations, ruleErr.Violations)
+		}
+		if ruleErr.StatusCode() != http.StatusUnprocessableEntity {
+			t.Errorf("%s: unexpected status %d", e.name, ruleErr.StatusCode())
+		}
+
+		// nothing is written when a rule is broken
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("%s: expected no files to be written, found %d", e.name, len(entries))
+		}
+	}
+}
+
+func TestTools_UploadOneFileRejectsBeforeWriting(t *testing.T) {
+	var testTools Tools
+	dir := t.TempDir()
+
+	request := newUploadRequest(t, nil,
+		testUploadFile{field: "file", name: "one.png", contents: testPNG(t)},
+		testUploadFile{field: "file", name: "two.png", contents: testPNG(t)},
+	)
+
+	_, err := testTools.UploadOneFile(request, dir)
+	var ruleErr *UploadRuleError
+	if !errors.As(err, &ruleErr) {
+		t.Fatalf("expected an *UploadRuleError, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected no files to be written, found %d", len(entries))
+	}
+
+	// a form without files
+	_, err = testTools.UploadOneFile(newUploadRequest(t, map[string]string{"title": "none"}), dir)
+	if err == nil {
+		t.Error("expected an error when no file is uploaded")
+	}
+}
@@ -0,0 +1,327 @@
+package toolkit
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Character classes used by PasswordPolicy
+const (
+	passwordLower   = "abcdefghijklmnopqrstuvwxyz"
+	passwordUpper   = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	passwordDigits  = "0123456789"
+	passwordSymbols = "!#$%&*+-=?@^_~"
+)
+
+// passwordAmbiguous are characters that are easily confused when read or typed
+const passwordAmbiguous = "0O1lI|"
+
+// Secret is a generated password, passphrase or key with its estimated strength
+type Secret struct {
+	Value string
+	// Entropy is the number of bits an attacker who knows the policy has to guess
+	Entropy float64
+}
+
+// PasswordPolicy describes the passwords made by GeneratePassword. Every enabled
+// character class appears at least once in each password; if no class is
+// enabled, all four are.
+type PasswordPolicy struct {
+	Length           int // defaults to 16
+	Lower            bool
+	Upper            bool
+	Digits           bool
+	Symbols          bool
+	SymbolSet        string // replaces the default symbols
+	Exclude          string // characters that never appear
+	ExcludeAmbiguous bool   // leave out 0, O, 1, l, I and |
+}
+
+// GeneratePassword returns a random password that satisfies the policy. Passwords are
+// drawn uniformly from every string that does, so the reported entropy is exact.
+func (t *Tools) GeneratePassword(policy PasswordPolicy) (Secret, error) {
+	length := policy.Length
+	if length == 0 {
+		length = 16
+	}
+
+	symbols := passwordSymbols
+	if policy.SymbolSet != "" {
+		symbols = policy.SymbolSet
+	}
+
+	var classes []string
+	for _, c := range []struct {
+		enabled bool
+		chars   string
+	}{
+		{policy.Lower, passwordLower},
+		{policy.Upper, passwordUpper},
+		{policy.Digits, passwordDigits},
+		{policy.Symbols, symbols},
+	} {
+		if c.enabled {
+			classes = append(classes, c.chars)
+		}
+	}
+	if len(classes) == 0 {
+		classes = []string{passwordLower, passwordUpper, passwordDigits, symbols}
+	}
+
+	exclude := policy.Exclude
+	if policy.ExcludeAmbiguous {
+		exclude += passwordAmbiguous
+	}
+
+	// Remove excluded characters, and characters already used by an earlier class
+	seen := make(map[rune]bool)
+	sets := make([][]rune, 0, len(classes))
+	var pool []rune
+	for _, class := range classes {
+		var set []rune
+		for _, c := range class {
+			if !seen[c] && !strings.ContainsRune(exclude, c) {
+				seen[c] = true
+				set = append(set, c)
+			}
+		}
+		if len(set) == 0 {
+			return Secret{}, fmt.Errorf("no characters left in class %q after exclusions", class)
+		}
+		sets = append(sets, set)
+		pool = append(pool, set...)
+	}
+
+	if length < len(sets) {
+		return Secret{}, fmt.Errorf("length %d is too short for %d required character classes", length, len(sets))
+	}
+	if err := validateAlphabet(pool); err != nil {
+		return Secret{}, err
+	}
+
+	// Rejection sampling: draw from the whole pool and retry until every class is present
+	for attempt := 0; attempt < 1000; attempt++ {
+		idx, err := randomIndexes(length, len(pool))
+		if err != nil {
+			return Secret{}, err
+		}
+
+		s := make([]rune, length)
+		for i, x := range idx {
+			s[i] = pool[x]
+		}
+
+		if containsEveryClass(s, sets) {
+			return Secret{Value: string(s), Entropy: passwordEntropy(length, sets)}, nil
+		}
+	}
+	return Secret{}, errors.New("could not generate a password that satisfies the policy")
+}
+
+// containsEveryClass reports whether s has at least one character from each set
+func containsEveryClass(s []rune, sets [][]rune) bool {
+	for _, set := range sets {
+		found := false
+		for _, c := range s {
+			for _, x := range set {
+				if c == x {
+					found = true
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// passwordEntropy returns log2 of the number of strings of the given length that
+// contain every set, counted by inclusion-exclusion over the missing sets
+func passwordEntropy(length int, sets [][]rune) float64 {
+	total := new(big.Int)
+	for mask := 0; mask < 1<<len(sets); mask++ {
+		size, missing := 0, 0
+		for i, set := range sets {
+			if mask&(1<<i) != 0 {
+				missing++
+			} else {
+				size += len(set)
+			}
+		}
+
+		term := new(big.Int).Exp(big.NewInt(int64(size)), big.NewInt(int64(length)), nil)
+		if missing%2 == 1 {
+			total.Sub(total, term)
+		} else {
+			total.Add(total, term)
+		}
+	}
+	return bigLog2(total)
+}
+
+// bigLog2 returns the base 2 logarithm of a positive integer
+func bigLog2(n *big.Int) float64 {
+	if n.Sign() <= 0 {
+		return 0
+	}
+	// Keep the top 53 bits so the float is exact enough, and add the rest back as a power of two
+	shift := n.BitLen() - 53
+	if shift < 0 {
+		shift = 0
+	}
+	f, _ := new(big.Float).SetInt(new(big.Int).Rsh(n, uint(shift))).Float64()
+	return math.Log2(f) + float64(shift)
+}
+
+// effWordlist is EFF's large diceware wordlist (CC BY 3.0 US, https://www.eff.org/dice),
+// one "rolls<TAB>word" pair per line
+//
+//go:embed wordlists/eff_large_wordlist.txt
+var effWordlist string
+
+// passphraseWords returns the words of the embedded wordlist
+var passphraseWords = sync.OnceValue(func() []string {
+	lines := strings.Split(strings.TrimSpace(effWordlist), "\n")
+	words := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if _, word, ok := strings.Cut(strings.TrimSpace(line), "\t"); ok {
+			words = append(words, word)
+		}
+	}
+	return words
+})
+
+// PassphrasePolicy describes the passphrases made by GeneratePassphrase
+type PassphrasePolicy struct {
+	Words       int    // defaults to 6
+	Separator   string // defaults to "-"
+	Capitalize  bool   // upper case the first letter of each word
+	AppendDigit bool   // add a random digit at the end
+}
+
+// GeneratePassphrase returns a diceware-style passphrase made of words picked at
+// random from the EFF large wordlist. Each word adds about 12.9 bits of entropy.
+func (t *Tools) GeneratePassphrase(policy PassphrasePolicy) (Secret, error) {
+	count := policy.Words
+	if count == 0 {
+		count = 6
+	}
+	if count < 0 {
+		return Secret{}, errors.New("number of words must not be negative")
+	}
+
+	separator := policy.Separator
+	if separator == "" {
+		separator = "-"
+	}
+
+	words := passphraseWords()
+	picked := make([]string, count)
+	for i := range picked {
+		x, err := randomInt(len(words))
+		if err != nil {
+			return Secret{}, err
+		}
+		picked[i] = words[x]
+		if policy.Capitalize {
+			r := []rune(picked[i])
+			r[0] = unicode.ToUpper(r[0])
+			picked[i] = string(r)
+		}
+	}
+
+	value := strings.Join(picked, separator)
+	entropy := float64(count) * math.Log2(float64(len(words)))
+
+	if policy.AppendDigit {
+		d, err := randomInt(10)
+		if err != nil {
+			return Secret{}, err
+		}
+		value += fmt.Sprint(d)
+		entropy += math.Log2(10)
+	}
+
+	return Secret{Value: value, Entropy: entropy}, nil
+}
+
+const (
+	// apiKeyRandomLength is the number of random base62 characters in an API key
+	apiKeyRandomLength = 30
+	// apiKeyChecksumLength is the number of base62 characters encoding the CRC32 checksum
+	apiKeyChecksumLength = 6
+)
+
+// apiKeyPrefixRegexp matches valid API key prefixes, like "tk_live"
+var apiKeyPrefixRegexp = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+
+// GenerateAPIKey returns an API key of the form <prefix>_<30 random characters><6 character checksum>,
+// for example tk_live_... The fixed prefix and the CRC32 checksum let secret scanners
+// find leaked keys without false positives, and let ParseAPIKey reject typos offline.
+func (t *Tools) GenerateAPIKey(prefix string) (Secret, error) {
+	if !apiKeyPrefixRegexp.MatchString(prefix) {
+		return Secret{}, fmt.Errorf("invalid API key prefix %q", prefix)
+	}
+
+	body, err := t.GenerateRandomString(apiKeyRandomLength, base62Alphabet)
+	if err != nil {
+		return Secret{}, err
+	}
+
+	key := prefix + "_" + body
+	return Secret{
+		Value:   key + apiKeyChecksum(key),
+		Entropy: apiKeyRandomLength * math.Log2(62),
+	}, nil
+}
+
+// ParseAPIKey checks the format and checksum of a key made by GenerateAPIKey and returns its prefix
+func ParseAPIKey(key string) (string, error) {
+	i := strings.LastIndexByte(key, '_')
+	if i < 0 {
+		return "", errors.New("API key has no prefix")
+	}
+
+	prefix, rest := key[:i], key[i+1:]
+	if !apiKeyPrefixRegexp.MatchString(prefix) {
+		return "", fmt.Errorf("invalid API key prefix %q", prefix)
+	}
+	if len(rest) != apiKeyRandomLength+apiKeyChecksumLength {
+		return "", errors.New("API key has the wrong length")
+	}
+	for i := 0; i < len(rest); i++ {
+		if strings.IndexByte(base62Alphabet, rest[i]) < 0 {
+			return "", fmt.Errorf("API key contains invalid character %q", rest[i])
+		}
+	}
+
+	body, checksum := key[:len(key)-apiKeyChecksumLength], key[len(key)-apiKeyChecksumLength:]
+	if apiKeyChecksum(body) != checksum {
+		return "", errors.New("API key checksum does not match")
+	}
+	return prefix, nil
+}
+
+// apiKeyChecksum returns the CRC32 of s as a zero padded base62 string
+func apiKeyChecksum(s string) string {
+	sum := crc32.ChecksumIEEE([]byte(s))
+	b := []byte(strings.Repeat("0", apiKeyChecksumLength))
+	for i := apiKeyChecksumLength - 1; i >= 0 && sum > 0; i-- {
+		b[i] = base62Alphabet[sum%62]
+		sum /= 62
+	}
+	return string(b)
+}
@@ -0,0 +1,133 @@
+package toolkit
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+var passwordTests = []struct {
+	name          string
+	policy        PasswordPolicy
+	length        int
+	mustContain   []string
+	mustNotUse    string
+	errorExpected bool
+}{
+	{name: "default", policy: PasswordPolicy{}, length: 16, mustContain: []string{passwordLower, passwordUpper, passwordDigits, passwordSymbols}},
+	{name: "digits only", policy: PasswordPolicy{Length: 6, Digits: true}, length: 6, mustContain: []string{passwordDigits}, mustNotUse: passwordLower + passwordUpper},
+	{name: "exclude ambiguous", policy: PasswordPolicy{Length: 40, ExcludeAmbiguous: true}, length: 40, mustNotUse: passwordAmbiguous},
+	{name: "custom symbols", policy: PasswordPolicy{Length: 12, Lower: true, Symbols: true, SymbolSet: "!?"}, length: 12, mustContain: []string{passwordLower, "!?"}, mustNotUse: "#$%&*+-=@^_~"},
+	{name: "too short", policy: PasswordPolicy{Length: 3}, errorExpected: true},
+	{name: "class fully excluded", policy: PasswordPolicy{Digits: true, Lower: true, Exclude: passwordDigits}, errorExpected: true},
+}
+
+func TestTools_GeneratePassword(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range passwordTests {
+		secret, err := testTools.GeneratePassword(e.policy)
+
+		if e.errorExpected && err == nil {
+			t.Errorf("%s: error expected but got none", e.name)
+		}
+		if !e.errorExpected && err != nil {
+			t.Errorf("%s: error not expected but got one: %s", e.name, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		if len([]rune(secret.Value)) != e.length {
+			t.Errorf("%s: expected length %d, got %d", e.name, e.length, len(secret.Value))
+		}
+		for _, class := range e.mustContain {
+			if !strings.ContainsAny(secret.Value, class) {
+				t.Errorf("%s: %q has no character from %q", e.name, secret.Value, class)
+			}
+		}
+		if e.mustNotUse != "" && strings.ContainsAny(secret.Value, e.mustNotUse) {
+			t.Errorf("%s: %q uses an excluded character", e.name, secret.Value)
+		}
+		if secret.Entropy <= 0 {
+			t.Errorf("%s: expected a positive entropy, got %f", e.name, secret.Entropy)
+		}
+	}
+}
+
+func TestPasswordEntropy(t *testing.T) {
+	// a single class is just length * log2(size)
+	if got := passwordEntropy(6, [][]rune{[]rune(passwordDigits)}); math.Abs(got-6*math.Log2(10)) > 1e-9 {
+		t.Errorf("expected %f, got %f", 6*math.Log2(10), got)
+	}
+
+	// two characters from {a} and {b} with both required: only "ab" and "ba"
+	if got := passwordEntropy(2, [][]rune{{'a'}, {'b'}}); math.Abs(got-1) > 1e-9 {
+		t.Errorf("expected 1 bit, got %f", got)
+	}
+}
+
+func TestTools_GeneratePassphrase(t *testing.T) {
+	var testTools Tools
+
+	if len(passphraseWords()) != 7776 {
+		t.Fatalf("expected 7776 words, got %d", len(passphraseWords()))
+	}
+
+	secret, err := testTools.GeneratePassphrase(PassphrasePolicy{Words: 5, Separator: " ", Capitalize: true, AppendDigit: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	words := strings.Split(secret.Value, " ")
+	if len(words) != 5 {
+		t.Errorf("expected 5 words, got %q", secret.Value)
+	}
+	if words[0][0] < 'A' || words[0][0] > 'Z' {
+		t.Errorf("expected capitalised words, got %q", secret.Value)
+	}
+	if last := secret.Value[len(secret.Value)-1]; last < '0' || last > '9' {
+		t.Errorf("expected a trailing digit, got %q", secret.Value)
+	}
+
+	expected := 5*math.Log2(7776) + math.Log2(10)
+	if math.Abs(secret.Entropy-expected) > 1e-9 {
+		t.Errorf("expected entropy %f, got %f", expected, secret.Entropy)
+	}
+}
+
+func TestTools_GenerateAPIKey(t *testing.T) {
+	var testTools Tools
+
+	secret, err := testTools.GenerateAPIKey("tk_live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(secret.Value, "tk_live_") {
+		t.Errorf("expected the tk_live_ prefix, got %s", secret.Value)
+	}
+
+	prefix, err := ParseAPIKey(secret.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefix != "tk_live" {
+		t.Errorf("expected prefix tk_live, got %s", prefix)
+	}
+
+	// change one character of the random part
+	tampered := []byte(secret.Value)
+	i := len("tk_live_")
+	if tampered[i] == 'a' {
+		tampered[i] = 'b'
+	} else {
+		tampered[i] = 'a'
+	}
+	if _, err := ParseAPIKey(string(tampered)); err == nil {
+		t.Error("expected a checksum error for a tampered key")
+	}
+
+	if _, err := testTools.GenerateAPIKey("Bad-Prefix"); err == nil {
+		t.Error("expected an error for an invalid prefix")
+	}
+}
@@ -0,0 +1,231 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrReservedSlug is returned when a slug is in SlugOptions.Reserved
+var ErrReservedSlug = errors.New("slug is reserved")
+
+// slugWordSplitter splits transliterated text into slug words
+var slugWordSplitter = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugSuffixAlphabet is used for the random suffixes of UniqueSlug
+const slugSuffixAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// SlugOptions configures SlugifyWithOptions and UniqueSlug
+type SlugOptions struct {
+	// Separator joins the words of the slug. Defaults to "-"
+	Separator string
+	// MaxLength cuts the slug at the last whole word that fits. Zero means no limit
+	MaxLength int
+	// Language selects the transliteration rules and stop-words. Defaults to t.SlugLanguage
+	Language string
+	// RemoveStopWords drops common words like "the" or "of", unless nothing else is left.
+	// English is used when no language is set
+	RemoveStopWords bool
+	// StopWords are removed in addition to the built-in list for Language
+	StopWords []string
+	// Reserved are slugs that are rejected with ErrReservedSlug, like "admin" or "new"
+	Reserved []string
+	// MaxAttempts is the number of numeric suffixes UniqueSlug tries before switching
+	// to random ones. Defaults to 100
+	MaxAttempts int
+	// RandomSuffix makes UniqueSlug use short random suffixes instead of -2, -3...
+	RandomSuffix bool
+}
+
+// separator returns the word separator
+func (o SlugOptions) separator() string {
+	if o.Separator == "" {
+		return "-"
+	}
+	return o.Separator
+}
+
+// SlugifyWithOptions returns a slug given a string, like Slugify, with a custom
+// separator, length limit, stop-word removal and reserved words
+func (t *Tools) SlugifyWithOptions(s string, opts SlugOptions) (string, error) {
+
+	if s == "" {
+		return "", errors.New("empty string is not permitted")
+	}
+
+	lang := opts.Language
+	if lang == "" {
+		lang = t.SlugLanguage
+	}
+
+	words := strings.Fields(slugWordSplitter.ReplaceAllString(transliterate(s, lang), " "))
+
+	if opts.RemoveStopWords {
+		words = removeStopWords(words, lang, opts.StopWords)
+	}
+
+	if len(words) == 0 {
+		return "", errors.New("after removing characters, slug is zero length")
+	}
+
+	slug := joinSlugWords(words, opts.separator(), opts.MaxLength)
+
+	for _, reserved := range opts.Reserved {
+		if strings.EqualFold(slug, reserved) {
+			return "", fmt.Errorf("%w: %s", ErrReservedSlug, slug)
+		}
+	}
+	return slug, nil
+}
+
+// joinSlugWords joins words with sep, stopping at the last word that fits in
+// maxLength. If even the first word is too long, it is cut.
+func joinSlugWords(words []string, sep string, maxLength int) string {
+	if maxLength <= 0 {
+		return strings.Join(words, sep)
+	}
+
+	if len(words[0]) >= maxLength {
+		return words[0][:maxLength]
+	}
+
+	slug := words[0]
+	for _, w := range words[1:] {
+		if len(slug)+len(sep)+len(w) > maxLength {
+			break
+		}
+		slug += sep + w
+	}
+	return slug
+}
+
+// removeStopWords drops the stop-words of the language and the extra ones. If that
+// would leave nothing, the words are returned unchanged.
+func removeStopWords(words []string, lang string, extra []string) []string {
+	if lang == "" {
+		lang = "en"
+	}
+
+	stop := make(map[string]bool)
+	// The words are compared after transliteration, so "für" matches "fuer"
+	for _, w := range strings.Fields(transliterate(stopWords[strings.ToLower(lang)], lang)) {
+		stop[w] = true
+	}
+	for _, w := range extra {
+		stop[transliterate(w, lang)] = true
+	}
+
+	kept := make([]string, 0, len(words))
+	for _, w := range words {
+		if !stop[w] {
+			kept = append(kept, w)
+		}
+	}
+	if len(kept) == 0 {
+		return words
+	}
+	return kept
+}
+
+// stopWords are the built-in stop-words by language
+var stopWords = map[string]string{
+	"en": "a an and are as at be but by for from in into is it of on or the this that to was were with",
+	"es": "a al como con de del el en es la las lo los o para por que se sin su sus un una unas unos y",
+	"fr": "a au aux avec ce ces dans de des du elle en et il la le les leur mais ou par pour qui sur un une",
+	"de": "am an auf aus bei das dem den der des die ein eine einem einen einer es für im in ist mit oder und von zu",
+	"it": "a al alla con da dei del della di e gli i il in la le lo nel o per su un una",
+	"pt": "a ao aos as com da das de do dos e em na nas no nos o os ou para por um uma",
+}
+
+// UniqueSlug returns slug if exists reports it as unused. Otherwise it appends -2, -3...
+// up to MaxAttempts, then tries short random suffixes made with GenerateRandomString. Only the
+// Separator, MaxLength, MaxAttempts and RandomSuffix options are used.
+func (t *Tools) UniqueSlug(slug string, exists func(slug string) (bool, error), opts ...SlugOptions) (string, error) {
+	var o SlugOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	if slug == "" {
+		return "", errors.New("empty string is not permitted")
+	}
+
+	maxAttempts := o.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = 100
+	}
+
+	candidate := slug
+	if o.MaxLength > 0 && len(candidate) > o.MaxLength {
+		candidate = cutSlug(candidate, o.MaxLength, o.separator())
+	}
+
+	if taken, err := exists(candidate); err != nil {
+		return "", err
+	} else if !taken {
+		return candidate, nil
+	}
+
+	if !o.RandomSuffix {
+		for n := 2; n <= maxAttempts; n++ {
+			candidate, err := appendSlugSuffix(slug, strconv.Itoa(n), o.separator(), o.MaxLength)
+			if err != nil {
+				return "", err
+			}
+			if taken, err := exists(candidate); err != nil {
+				return "", err
+			} else if !taken {
+				return candidate, nil
+			}
+		}
+	}
+
+	for attempt := 0; attempt < 10; attempt++ {
+		suffix, err := t.GenerateRandomString(6, slugSuffixAlphabet)
+		if err != nil {
+			return "", err
+		}
+		candidate, err = appendSlugSuffix(slug, suffix, o.separator(), o.MaxLength)
+		if err != nil {
+			return "", err
+		}
+		if taken, err := exists(candidate); err != nil {
+			return "", err
+		} else if !taken {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("could not find a unique slug for %q", slug)
+}
+
+// appendSlugSuffix adds suffix to slug, shortening slug so the result fits in maxLength.
+// It fails if not even one character of slug fits.
+func appendSlugSuffix(slug, suffix, sep string, maxLength int) (string, error) {
+	if maxLength > 0 {
+		room := maxLength - len(sep) - len(suffix)
+		if room < 1 {
+			return "", fmt.Errorf("a slug with the suffix %q doesn't fit in %d characters", sep+suffix, maxLength)
+		}
+		if room < len(slug) {
+			slug = cutSlug(slug, room, sep)
+		}
+	}
+	return slug + sep + suffix, nil
+}
+
+// cutSlug cuts slug to n bytes, without leaving a separator, or part of one, at the end
+func cutSlug(slug string, n int, sep string) string {
+	cut := slug[:n]
+	for i := 1; i < len(sep); i++ {
+		if strings.HasSuffix(cut, sep[:i]) && strings.HasPrefix(slug[n:], sep[i:]) {
+			cut = cut[:len(cut)-i]
+			break
+		}
+	}
+	for sep != "" && strings.HasSuffix(cut, sep) {
+		cut = strings.TrimSuffix(cut, sep)
+	}
+	return cut
+}
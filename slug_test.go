@@ -0,0 +1,119 @@
+package toolkit
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+)
+
+var slugOptionsTests = []struct {
+	name          string
+	s             string
+	opts          SlugOptions
+	expected      string
+	errorExpected bool
+}{
+	{name: "defaults", s: "Hello World", expected: "hello-world"},
+	{name: "underscore separator", s: "Hello World", opts: SlugOptions{Separator: "_"}, expected: "hello_world"},
+	{name: "max length on word boundary", s: "The quick brown fox jumps", opts: SlugOptions{MaxLength: 17}, expected: "the-quick-brown"},
+	{name: "max length long first word", s: "Supercalifragilistic word", opts: SlugOptions{MaxLength: 5}, expected: "super"},
+	{name: "english stop words", s: "The Lord of the Rings", opts: SlugOptions{RemoveStopWords: true}, expected: "lord-rings"},
+	{name: "spanish stop words", s: "El señor de los anillos", opts: SlugOptions{RemoveStopWords: true, Language: "es"}, expected: "senor-anillos"},
+	{name: "german stop words", s: "Brot für die Welt", opts: SlugOptions{RemoveStopWords: true, Language: "de"}, expected: "brot-welt"},
+	{name: "extra stop words", s: "Breaking news today", opts: SlugOptions{RemoveStopWords: true, StopWords: []string{"Breaking"}}, expected: "news-today"},
+	{name: "only stop words", s: "The And", opts: SlugOptions{RemoveStopWords: true}, expected: "the-and"},
+	{name: "german language", s: "Über uns", opts: SlugOptions{Language: "de"}, expected: "ueber-uns"},
+	{name: "reserved", s: "Admin", opts: SlugOptions{Reserved: []string{"admin"}}, errorExpected: true},
+	{name: "empty", s: "", errorExpected: true},
+}
+
+func TestTools_SlugifyWithOptions(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range slugOptionsTests {
+		slug, err := testTools.SlugifyWithOptions(e.s, e.opts)
+
+		if e.errorExpected && err == nil {
+			t.Errorf("%s: error expected but got none", e.name)
+		}
+		if !e.errorExpected && err != nil {
+			t.Errorf("%s: error not expected but got one: %s", e.name, err)
+		}
+		if !e.errorExpected && slug != e.expected {
+			t.Errorf("%s: expected %s, got %s", e.name, e.expected, slug)
+		}
+	}
+
+	_, err := testTools.SlugifyWithOptions("new", SlugOptions{Reserved: []string{"new"}})
+	if !errors.Is(err, ErrReservedSlug) {
+		t.Errorf("expected ErrReservedSlug, got %v", err)
+	}
+}
+
+func TestTools_UniqueSlug(t *testing.T) {
+	var testTools Tools
+
+	existing := map[string]bool{"post": true, "post-2": true, "long-title": true}
+	exists := func(slug string) (bool, error) {
+		return existing[slug], nil
+	}
+
+	slug, err := testTools.UniqueSlug("fresh", exists)
+	if err != nil || slug != "fresh" {
+		t.Errorf("expected fresh, got %s (%v)", slug, err)
+	}
+
+	slug, err = testTools.UniqueSlug("post", exists)
+	if err != nil || slug != "post-3" {
+		t.Errorf("expected post-3, got %s (%v)", slug, err)
+	}
+
+	slug, err = testTools.UniqueSlug("long-title", exists, SlugOptions{MaxLength: 10})
+	if err != nil || slug != "long-tit-2" {
+		t.Errorf("expected long-tit-2, got %s (%v)", slug, err)
+	}
+
+	slug, err = testTools.UniqueSlug("abc-def", exists, SlugOptions{MaxLength: 4})
+	if err != nil || slug != "abc" {
+		t.Errorf("expected abc, got %s (%v)", slug, err)
+	}
+
+	// a separator that is more than one character is only trimmed as a whole
+	slug, err = testTools.UniqueSlug("ab--cd", exists, SlugOptions{Separator: "--", MaxLength: 3})
+	if err != nil || slug != "ab" {
+		t.Errorf("expected ab, got %s (%v)", slug, err)
+	}
+	slug, err = testTools.UniqueSlug("ab_-cd", exists, SlugOptions{Separator: "_-", MaxLength: 4})
+	if err != nil || slug != "ab" {
+		t.Errorf("expected ab, got %s (%v)", slug, err)
+	}
+	slug, err = testTools.UniqueSlug("a-_-b", exists, SlugOptions{Separator: "_-", MaxLength: 3})
+	if err != nil || slug != "a-" {
+		t.Errorf("expected a-, got %s (%v)", slug, err)
+	}
+
+	// the suffix must leave room for the slug
+	calls := 0
+	taken := func(string) (bool, error) { calls++; return true, nil }
+	if _, err = testTools.UniqueSlug("post", taken, SlugOptions{MaxLength: 2}); err == nil || calls != 1 {
+		t.Errorf("expected an error when the suffix doesn't fit, got %v after %d calls", err, calls)
+	}
+
+	slug, err = testTools.UniqueSlug("post", exists, SlugOptions{RandomSuffix: true})
+	if err != nil || !regexp.MustCompile(`^post-[a-z0-9]{6}$`).MatchString(slug) {
+		t.Errorf("expected a random suffix, got %s (%v)", slug, err)
+	}
+
+	// everything is taken
+	_, err = testTools.UniqueSlug("post", func(string) (bool, error) { return true, nil }, SlugOptions{MaxAttempts: 3})
+	if err == nil {
+		t.Error("expected an error when every candidate is taken")
+	}
+
+	// errors from the callback are returned
+	failure := errors.New("database is down")
+	_, err = testTools.UniqueSlug("post", func(string) (bool, error) { return false, failure })
+	if !errors.Is(err, failure) {
+		t.Errorf("expected the callback error, got %v", err)
+	}
+}
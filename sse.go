@@ -0,0 +1,335 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSSEHeartbeat is the interval between heartbeats when Tools.SSEHeartbeat is zero
+const defaultSSEHeartbeat = 15 * time.Second
+
+// sseSubscriberBuffer is the number of events a broker subscriber can fall behind by
+// before it is dropped. Dropped clients reconnect and catch up with Last-Event-ID.
+const sseSubscriberBuffer = 64
+
+// SSEEvent is one server-sent event
+type SSEEvent struct {
+	// ID is sent back by the browser in the Last-Event-ID header when it reconnects
+	ID string
+	// Event is the event name. Browsers dispatch events without a name as "message"
+	Event string
+	// Data is encoded as JSON
+	Data any
+	// Retry tells the browser how long to wait before reconnecting
+	Retry time.Duration
+}
+
+// SSEWriter writes server-sent events to a response. It is safe for concurrent use.
+type SSEWriter struct {
+	mu sync.Mutex
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// NewSSEWriter sets the headers of an event stream, sends them, and returns a writer
+// for the events. If the response can't be flushed, it fails before anything is written,
+// so the caller can still answer with an error.
+func (t *Tools) NewSSEWriter(w http.ResponseWriter) (*SSEWriter, error) {
+	if !canFlush(w) {
+		return nil, fmt.Errorf("event streams need a response that can be flushed: %w", http.ErrNotSupported)
+	}
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Stop proxies such as nginx from holding events back
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := rc.Flush(); err != nil {
+		return nil, err
+	}
+	return &SSEWriter{w: w, rc: rc}, nil
+}
+
+// canFlush reports whether w, or a writer it wraps, can be flushed by http.ResponseController
+func canFlush(w http.ResponseWriter) bool {
+	for {
+		switch w.(type) {
+		case http.Flusher, interface{ FlushError() error }:
+			return true
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		w = u.Unwrap()
+	}
+}
+
+// Send writes an event and flushes it to the client
+func (s *SSEWriter) Send(e SSEEvent) error {
+	if strings.ContainsAny(e.ID, "\r\n\x00") || strings.ContainsAny(e.Event, "\r\n") {
+		return errors.New("event ID and name must not contain line breaks")
+	}
+
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if e.ID != "" {
+		fmt.Fprintf(&buf, "id: %s\n", e.ID)
+	}
+	if e.Event != "" {
+		fmt.Fprintf(&buf, "event: %s\n", e.Event)
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&buf, "retry: %d\n", e.Retry.Milliseconds())
+	}
+	fmt.Fprintf(&buf, "data: %s\n\n", data)
+
+	return s.write(buf.Bytes())
+}
+
+// Comment writes a comment line, which clients ignore. It keeps idle connections open
+func (s *SSEWriter) Comment(text string) error {
+	var buf bytes.Buffer
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Fprintf(&buf, ": %s\n", strings.TrimSuffix(line, "\r"))
+	}
+	buf.WriteString("\n")
+
+	return s.write(buf.Bytes())
+}
+
+// write writes b and flushes it
+func (s *SSEWriter) write(b []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.w.Write(b); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// EventBuffer keeps recent events so clients that reconnect with a Last-Event-ID
+// header get the events they missed. Implementations must be safe for concurrent use.
+type EventBuffer interface {
+	// Add keeps an event
+	Add(e SSEEvent)
+	// Since returns the events after the one with the given ID, or every event kept
+	// if that ID is no longer in the buffer
+	Since(lastID string) []SSEEvent
+}
+
+// MemoryEventBuffer is an EventBuffer that keeps the most recent events in memory
+type MemoryEventBuffer struct {
+	mu     sync.Mutex
+	events []SSEEvent
+	start  int
+	size   int
+}
+
+// NewMemoryEventBuffer returns a buffer that keeps the last size events
+func NewMemoryEventBuffer(size int) *MemoryEventBuffer {
+	if size < 1 {
+		size = 1
+	}
+	return &MemoryEventBuffer{events: make([]SSEEvent, 0, size), size: size}
+}
+
+// Add implements EventBuffer
+func (b *MemoryEventBuffer) Add(e SSEEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.events) < b.size {
+		b.events = append(b.events, e)
+		return
+	}
+	// Overwrite the oldest event
+	b.events[b.start] = e
+	b.start = (b.start + 1) % b.size
+}
+
+// Since implements EventBuffer
+func (b *MemoryEventBuffer) Since(lastID string) []SSEEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ordered := make([]SSEEvent, 0, len(b.events))
+	ordered = append(ordered, b.events[b.start:]...)
+	ordered = append(ordered, b.events[:b.start]...)
+
+	for i := len(ordered) - 1; i >= 0; i-- {
+		if ordered[i].ID == lastID {
+			return ordered[i+1:]
+		}
+	}
+	return ordered
+}
+
+// StreamSSE streams events to the client until the channel is closed or the client goes
+// away. If the client reconnects with a Last-Event-ID header, the events it missed are
+// sent from replay first. Heartbeat comments are sent every t.SSEHeartbeat.
+func (t *Tools) StreamSSE(w http.ResponseWriter, r *http.Request, events <-chan SSEEvent, replay EventBuffer) error {
+	sse, err := t.NewSSEWriter(w)
+	if err != nil {
+		return err
+	}
+
+	var missed []SSEEvent
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" && replay != nil {
+		missed = replay.Since(lastID)
+	}
+	return t.streamSSE(r.Context(), sse, missed, events)
+}
+
+// streamSSE sends the missed events, then the events from the channel, with heartbeats in between
+func (t *Tools) streamSSE(ctx context.Context, sse *SSEWriter, missed []SSEEvent, events <-chan SSEEvent) error {
+	for _, e := range missed {
+		if err := sse.Send(e); err != nil {
+			return err
+		}
+	}
+
+	var heartbeat <-chan time.Time
+	if interval := t.sseHeartbeat(); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat:
+			if err := sse.Comment("heartbeat"); err != nil {
+				return err
+			}
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := sse.Send(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sseHeartbeat returns the interval between heartbeats, or zero if they are disabled
+func (t *Tools) sseHeartbeat() time.Duration {
+	switch {
+	case t.SSEHeartbeat < 0:
+		return 0
+	case t.SSEHeartbeat == 0:
+		return defaultSSEHeartbeat
+	}
+	return t.SSEHeartbeat
+}
+
+// SSEBroker fans published events out to every subscriber, and serves them as event
+// streams. Events without an ID get a sequential one, so clients can catch up from
+// the broker's buffer when they reconnect. It is safe for concurrent use.
+type SSEBroker struct {
+	tools  *Tools
+	buffer EventBuffer
+
+	mu     sync.Mutex
+	nextID uint64
+	subs   map[chan SSEEvent]struct{}
+}
+
+// NewSSEBroker returns a broker that keeps published events in buffer for replay.
+// The buffer may be nil to disable replay.
+func (t *Tools) NewSSEBroker(buffer EventBuffer) *SSEBroker {
+	return &SSEBroker{
+		tools:  t,
+		buffer: buffer,
+		subs:   make(map[chan SSEEvent]struct{}),
+	}
+}
+
+// Publish sends an event to every subscriber. Subscribers that fall too far behind are
+// dropped: their channel is closed, and a client can reconnect to catch up.
+func (b *SSEBroker) Publish(e SSEEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	if e.ID == "" {
+		e.ID = strconv.FormatUint(b.nextID, 10)
+	}
+	if b.buffer != nil {
+		b.buffer.Add(e)
+	}
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns a channel with the events published from now on, and a function to unsubscribe
+func (b *SSEBroker) Subscribe() (<-chan SSEEvent, func()) {
+	ch, _, unsubscribe := b.subscribe("")
+	return ch, unsubscribe
+}
+
+// subscribe adds a subscriber and, if lastID is set, returns the buffered events after it.
+// Both happen under the lock, so no event is missed or sent twice in between.
+func (b *SSEBroker) subscribe(lastID string) (chan SSEEvent, []SSEEvent, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var missed []SSEEvent
+	if lastID != "" && b.buffer != nil {
+		missed = b.buffer.Since(lastID)
+	}
+
+	ch := make(chan SSEEvent, sseSubscriberBuffer)
+	b.subs[ch] = struct{}{}
+
+	return ch, missed, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// ServeHTTP streams the published events to the client, starting with the events it
+// missed if it reconnects with a Last-Event-ID header. If the response can't be
+// streamed, the client gets a 500.
+func (b *SSEBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ch, missed, unsubscribe := b.subscribe(r.Header.Get("Last-Event-ID"))
+	defer unsubscribe()
+
+	sse, err := b.tools.NewSSEWriter(w)
+	if err != nil {
+		b.tools.requestLogger(r).Error("event stream failed", "error", err)
+		_ = b.tools.ErrorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	_ = b.tools.streamSSE(r.Context(), sse, missed, ch)
+}
@@ -0,0 +1,228 @@
+package toolkit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSEWriter(t *testing.T) {
+	var testTools Tools
+	rr := httptest.NewRecorder()
+
+	sse, err := testTools.NewSSEWriter(rr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+
+	err = sse.Send(SSEEvent{ID: "7", Event: "update", Data: map[string]int{"n": 1}, Retry: 3 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sse.Comment("ping"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "id: 7\nevent: update\nretry: 3000\ndata: {\"n\":1}\n\n: ping\n\n"
+	if rr.Body.String() != expected {
+		t.Errorf("expected %q, got %q", expected, rr.Body.String())
+	}
+
+	if err := sse.Send(SSEEvent{Event: "bad\nname"}); err == nil {
+		t.Error("expected an error for an event name with a line break")
+	}
+}
+
+// unflushableWriter is a response writer that can't be flushed
+type unflushableWriter struct {
+	http.ResponseWriter
+}
+
+func TestSSEWriterUnflushable(t *testing.T) {
+	testTools := Tools{Logger: slog.New(slog.DiscardHandler)}
+
+	rr := httptest.NewRecorder()
+	if _, err := testTools.NewSSEWriter(unflushableWriter{rr}); !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("expected http.ErrNotSupported, got %v", err)
+	}
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "" || rr.Flushed {
+		t.Errorf("expected nothing to be written, got %d %v", rr.Code, rr.Header())
+	}
+
+	// the broker answers with an error instead of an empty stream
+	rr = httptest.NewRecorder()
+	testTools.NewSSEBroker(nil).ServeHTTP(unflushableWriter{rr}, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusInternalServerError || rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected a JSON 500, got %d %v", rr.Code, rr.Header())
+	}
+}
+
+func TestMemoryEventBuffer(t *testing.T) {
+	buffer := NewMemoryEventBuffer(3)
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		buffer.Add(SSEEvent{ID: id})
+	}
+
+	ids := func(events []SSEEvent) string {
+		var s []string
+		for _, e := range events {
+			s = append(s, e.ID)
+		}
+		return strings.Join(s, ",")
+	}
+
+	if got := ids(buffer.Since("3")); got != "4,5" {
+		t.Errorf("expected the events after 3, got %s", got)
+	}
+	if got := ids(buffer.Since("5")); got != "" {
+		t.Errorf("expected no events after the last one, got %s", got)
+	}
+	// an ID that is no longer buffered gets everything kept
+	if got := ids(buffer.Since("1")); got != "3,4,5" {
+		t.Errorf("expected every buffered event, got %s", got)
+	}
+}
+
+func TestTools_StreamSSE(t *testing.T) {
+	testTools := Tools{SSEHeartbeat: 10 * time.Millisecond}
+
+	replay := NewMemoryEventBuffer(10)
+	replay.Add(SSEEvent{ID: "1", Data: "one"})
+	replay.Add(SSEEvent{ID: "2", Data: "two"})
+
+	events := make(chan SSEEvent, 1)
+	events <- SSEEvent{ID: "3", Data: "three"}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(events)
+	}()
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Last-Event-ID", "1")
+	rr := httptest.NewRecorder()
+
+	if err := testTools.StreamSSE(rr, request, events, replay); err != nil {
+		t.Fatal(err)
+	}
+
+	body := rr.Body.String()
+	if !strings.HasPrefix(body, "id: 2\ndata: \"two\"\n\nid: 3\ndata: \"three\"\n\n") {
+		t.Errorf("expected the missed event and then the new one, got %q", body)
+	}
+	if strings.Contains(body, "\"one\"") {
+		t.Error("the event the client already had was sent again")
+	}
+	if !strings.Contains(body, ": heartbeat\n") {
+		t.Error("expected a heartbeat")
+	}
+}
+
+func TestTools_StreamSSEStopsOnCancel(t *testing.T) {
+	testTools := Tools{SSEHeartbeat: -1}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	request := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+
+	done := make(chan error)
+	go func() { done <- testTools.StreamSSE(httptest.NewRecorder(), request, make(chan SSEEvent), nil) }()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the stream did not stop when the request was canceled")
+	}
+}
+
+func TestSSEBroker(t *testing.T) {
+	testTools := Tools{SSEHeartbeat: -1}
+	broker := testTools.NewSSEBroker(NewMemoryEventBuffer(10))
+
+	server := httptest.NewServer(broker)
+	defer server.Close()
+
+	broker.Publish(SSEEvent{Event: "note", Data: "before"})
+
+	// two clients, one catching up from the first event
+	readers := make([]*bufio.Reader, 2)
+	for i := range readers {
+		request, _ := http.NewRequest("GET", server.URL, nil)
+		if i == 1 {
+			request.Header.Set("Last-Event-ID", "0")
+		}
+		resp, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		readers[i] = bufio.NewReader(resp.Body)
+	}
+
+	// wait for both subscribers before publishing
+	deadline := time.Now().Add(time.Second)
+	for {
+		broker.mu.Lock()
+		n := len(broker.subs)
+		broker.mu.Unlock()
+		if n == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	broker.Publish(SSEEvent{Event: "note", Data: "after"})
+
+	readData := func(r *bufio.Reader) string {
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, ok := strings.CutPrefix(line, "data: "); ok {
+				return strings.TrimSpace(data)
+			}
+		}
+	}
+
+	if got := readData(readers[0]); got != `"after"` {
+		t.Errorf("expected the new event, got %s", got)
+	}
+	if got := readData(readers[1]); got != `"before"` {
+		t.Errorf("expected the replayed event first, got %s", got)
+	}
+	if got := readData(readers[1]); got != `"after"` {
+		t.Errorf("expected the new event after the replay, got %s", got)
+	}
+}
+
+func TestSSEBrokerDropsSlowSubscribers(t *testing.T) {
+	var testTools Tools
+	broker := testTools.NewSSEBroker(nil)
+
+	ch, unsubscribe := broker.Subscribe()
+	defer unsubscribe()
+
+	for i := 0; i <= sseSubscriberBuffer; i++ {
+		broker.Publish(SSEEvent{Data: i})
+	}
+
+	n := 0
+	for range ch {
+		n++
+	}
+	if n != sseSubscriberBuffer {
+		t.Errorf("expected %d events before the channel was closed, got %d", sseSubscriberBuffer, n)
+	}
+}
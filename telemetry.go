@@ -0,0 +1,202 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer and the meter of the toolkit
+const instrumentationName = "github.com/juanatsap/go-toolkit"
+
+// Reasons an upload is rejected, used as the reason attribute of the rejected uploads metric
+const (
+	uploadRejectForm  = "form"
+	uploadRejectRules = "rules"
+	uploadRejectQuota = "quota"
+	uploadRejectOther = "other"
+)
+
+// observer receives the events of toolkit operations, to turn them into metrics
+type observer interface {
+	uploadAccepted(ctx context.Context, files int, bytes int64)
+	uploadRejected(ctx context.Context, reason string)
+	jsonReadFailed(ctx context.Context, errorType string)
+	responseWritten(status int)
+	remotePushed(ctx context.Context, status int, err error, latency time.Duration)
+}
+
+// observers returns every observer the events of t go to. The OpenTelemetry instruments
+// are created on first use, from the meter provider set at that time.
+func (t *Tools) observers() []observer {
+	t.instrumentsOnce.Do(func() {
+		t.instruments = newOtelInstruments(t.meterProvider())
+	})
+	observers := []observer{t.instruments}
+	if t.Metrics != nil {
+		observers = append(observers, t.Metrics.observer())
+	}
+	return observers
+}
+
+// tracerProvider returns t.TracerProvider, or the global one if it isn't set
+func (t *Tools) tracerProvider() trace.TracerProvider {
+	if t.TracerProvider != nil {
+		return t.TracerProvider
+	}
+	return otel.GetTracerProvider()
+}
+
+// meterProvider returns t.MeterProvider, or the global one if it isn't set
+func (t *Tools) meterProvider() metric.MeterProvider {
+	if t.MeterProvider != nil {
+		return t.MeterProvider
+	}
+	return otel.GetMeterProvider()
+}
+
+// startSpan starts a span for a toolkit operation. Only the methods that get a request or
+// a context start spans, so they join the caller's trace. WriteJSON, ErrorJSON, the slug
+// helpers and CreateDirIfNotExist get neither, and a span of theirs would start a trace of
+// its own; responses are counted by the toolkit.json.responses metric instead.
+func (t *Tools) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return t.tracerProvider().Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err on span, if there is one, and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// instrumentedClient returns a copy of client whose transport traces requests and
+// propagates the trace context to the remote service
+func (t *Tools) instrumentedClient(client *http.Client) *http.Client {
+	instrumented := *client
+	instrumented.Transport = otelhttp.NewTransport(client.Transport,
+		otelhttp.WithTracerProvider(t.tracerProvider()),
+		otelhttp.WithMeterProvider(t.meterProvider()),
+		otelhttp.WithPropagators(otel.GetTextMapPropagator()))
+	return &instrumented
+}
+
+// uploadRejectReason returns the reason attribute for an upload stopped by err
+func uploadRejectReason(err error) string {
+	var ruleError *UploadRuleError
+	var quotaError *QuotaError
+	switch {
+	case errors.As(err, &ruleError):
+		return uploadRejectRules
+	case errors.As(err, &quotaError):
+		return uploadRejectQuota
+	default:
+		return uploadRejectOther
+	}
+}
+
+// jsonReadErrorType returns the type of error, for metrics, of a body ReadJSON couldn't
+// decode. decodeErr is the error of the decoder, nil if the body had more than one value
+func jsonReadErrorType(decodeErr error) string {
+	var syntaxError *json.SyntaxError
+	var unmarshalTypeError *json.UnmarshalTypeError
+	var maxBytesError *http.MaxBytesError
+	switch {
+	case decodeErr == nil:
+		return "trailing_data"
+	case errors.As(decodeErr, &maxBytesError):
+		return "too_large"
+	case errors.As(decodeErr, &syntaxError), errors.Is(decodeErr, io.ErrUnexpectedEOF):
+		return "syntax"
+	case errors.As(decodeErr, &unmarshalTypeError):
+		return "type"
+	case errors.Is(decodeErr, io.EOF):
+		return "empty"
+	case strings.HasPrefix(decodeErr.Error(), "json: unknown field "):
+		return "unknown_field"
+	default:
+		return "other"
+	}
+}
+
+// otelInstruments records the events of toolkit operations as OpenTelemetry metrics.
+// Instruments that can't be created are no-ops, as the OpenTelemetry API intends.
+type otelInstruments struct {
+	uploadSize     metric.Int64Counter
+	uploadFiles    metric.Int64Counter
+	uploadRejects  metric.Int64Counter
+	jsonReadErrors metric.Int64Counter
+	jsonResponses  metric.Int64Counter
+	remoteDuration metric.Float64Histogram
+}
+
+// newOtelInstruments creates the instruments of a meter provider
+func newOtelInstruments(provider metric.MeterProvider) *otelInstruments {
+	meter := provider.Meter(instrumentationName)
+	counter := func(name, unit, description string) metric.Int64Counter {
+		c, err := meter.Int64Counter(name, metric.WithUnit(unit), metric.WithDescription(description))
+		if err != nil {
+			return noop.Int64Counter{}
+		}
+		return c
+	}
+
+	o := &otelInstruments{
+		uploadSize:     counter("toolkit.upload.size", "By", "Bytes written by uploads"),
+		uploadFiles:    counter("toolkit.upload.files", "{file}", "Files written by uploads"),
+		uploadRejects:  counter("toolkit.upload.rejected", "{upload}", "Uploads rejected before anything was written, by reason"),
+		jsonReadErrors: counter("toolkit.json.read.errors", "{request}", "Request bodies ReadJSON couldn't decode, by type of error"),
+		jsonResponses:  counter("toolkit.json.responses", "{response}", "Responses written by WriteJSON and ErrorJSON, by status code"),
+	}
+	var err error
+	o.remoteDuration, err = meter.Float64Histogram("toolkit.remote.duration",
+		metric.WithUnit("s"), metric.WithDescription("Duration of JSON pushes to remote services, by status"))
+	if err != nil {
+		o.remoteDuration = noop.Float64Histogram{}
+	}
+	return o
+}
+
+// uploadAccepted implements observer
+func (o *otelInstruments) uploadAccepted(ctx context.Context, files int, bytes int64) {
+	o.uploadSize.Add(ctx, bytes)
+	o.uploadFiles.Add(ctx, int64(files))
+}
+
+// uploadRejected implements observer
+func (o *otelInstruments) uploadRejected(ctx context.Context, reason string) {
+	o.uploadRejects.Add(ctx, 1, metric.WithAttributes(attribute.String("reason", reason)))
+}
+
+// jsonReadFailed implements observer
+func (o *otelInstruments) jsonReadFailed(ctx context.Context, errorType string) {
+	o.jsonReadErrors.Add(ctx, 1, metric.WithAttributes(attribute.String("error.type", errorType)))
+}
+
+// responseWritten implements observer
+func (o *otelInstruments) responseWritten(status int) {
+	o.jsonResponses.Add(context.Background(), 1, metric.WithAttributes(attribute.Int("http.response.status_code", status)))
+}
+
+// remotePushed implements observer
+func (o *otelInstruments) remotePushed(ctx context.Context, status int, err error, latency time.Duration) {
+	attrs := []attribute.KeyValue{attribute.Int("http.response.status_code", status)}
+	if err != nil {
+		attrs = []attribute.KeyValue{attribute.String("error.type", "request_failed")}
+	}
+	o.remoteDuration.Record(ctx, latency.Seconds(), metric.WithAttributes(attrs...))
+}
@@ -0,0 +1,195 @@
+package toolkit
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// newTelemetryTools returns Tools that record spans and metrics in memory
+func newTelemetryTools() (*Tools, *tracetest.SpanRecorder, *sdkmetric.ManualReader) {
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	return &Tools{
+		Logger:         slog.New(slog.DiscardHandler),
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)),
+		MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+	}, spans, reader
+}
+
+// collectMetric returns the data of the metric with the given name
+func collectMetric(t *testing.T, reader *sdkmetric.ManualReader, name string) metricdata.Aggregation {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+	t.Fatalf("metric %s wasn't recorded", name)
+	return nil
+}
+
+func TestTools_TelemetryUpload(t *testing.T) {
+	testTools, spans, reader := newTelemetryTools()
+	dir := t.TempDir()
+
+	request := newUploadRequest(t, nil, testUploadFile{field: "file", name: "logo.png", contents: testPNG(t)})
+	if _, err := testTools.UploadFiles(request, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	testTools.AllowedFileTypes = []string{"image/jpeg"}
+	request = newUploadRequest(t, nil, testUploadFile{field: "file", name: "logo.png", contents: testPNG(t)})
+	if _, err := testTools.UploadFiles(request, dir); err == nil {
+		t.Fatal("expected the upload to be rejected")
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 2 || ended[0].Name() != "toolkit.UploadFiles" {
+		t.Fatalf("unexpected spans %v", ended)
+	}
+	if ended[0].Status().Code == codes.Error || ended[1].Status().Code != codes.Error {
+		t.Errorf("expected only the rejected upload to fail, got %v and %v", ended[0].Status(), ended[1].Status())
+	}
+
+	files := collectMetric(t, reader, "toolkit.upload.files").(metricdata.Sum[int64])
+	if len(files.DataPoints) != 1 || files.DataPoints[0].Value != 1 {
+		t.Errorf("unexpected file count %+v", files.DataPoints)
+	}
+	size := collectMetric(t, reader, "toolkit.upload.size").(metricdata.Sum[int64])
+	if len(size.DataPoints) != 1 || size.DataPoints[0].Value != int64(len(testPNG(t))) {
+		t.Errorf("unexpected upload size %+v", size.DataPoints)
+	}
+	rejected := collectMetric(t, reader, "toolkit.upload.rejected").(metricdata.Sum[int64])
+	if len(rejected.DataPoints) != 1 || rejected.DataPoints[0].Attributes != attribute.NewSet(attribute.String("reason", uploadRejectRules)) {
+		t.Errorf("unexpected rejects %+v", rejected.DataPoints)
+	}
+}
+
+func TestTools_TelemetryPushJSON(t *testing.T) {
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(previous)
+
+	testTools, spans, reader := newTelemetryTools()
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	ctx, parent := testTools.tracerProvider().Tracer("test").Start(context.Background(), "handler")
+	_, status, err := testTools.PushJSONToRemoteContext(ctx, server.URL, map[string]string{"foo": "bar"})
+	parent.End()
+	if err != nil || status != http.StatusCreated {
+		t.Fatalf("unexpected push result %d %v", status, err)
+	}
+
+	if traceparent == "" {
+		t.Error("expected the trace context to be sent to the remote service")
+	}
+	for _, span := range spans.Ended() {
+		if span.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+			t.Errorf("span %s isn't part of the request trace", span.Name())
+		}
+	}
+	if names := len(spans.Ended()); names != 3 {
+		t.Errorf("expected the handler, push and HTTP client spans, got %d", names)
+	}
+
+	duration := collectMetric(t, reader, "toolkit.remote.duration").(metricdata.Histogram[float64])
+	if len(duration.DataPoints) != 1 || duration.DataPoints[0].Count != 1 {
+		t.Fatalf("unexpected remote durations %+v", duration.DataPoints)
+	}
+	if v, _ := duration.DataPoints[0].Attributes.Value("http.response.status_code"); v.AsInt64() != http.StatusCreated {
+		t.Errorf("unexpected status attribute %v", v)
+	}
+}
+
+func TestTools_TelemetryReadJSON(t *testing.T) {
+	testTools, spans, _ := newTelemetryTools()
+
+	var data struct{ Foo string }
+	request := httptest.NewRequest("POST", "/", nil)
+	_ = testTools.ReadJSON(httptest.NewRecorder(), request, &data)
+
+	ended := spans.Ended()
+	if len(ended) != 1 || ended[0].Name() != "toolkit.ReadJSON" || ended[0].Status().Code != codes.Error {
+		t.Errorf("unexpected spans %v", ended)
+	}
+}
+
+// sliceMeterProvider is a meter provider whose values can't be used as map keys
+type sliceMeterProvider struct {
+	metric.MeterProvider
+	options []string
+}
+
+func TestTools_TelemetryUnhashableProvider(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	testTools := Tools{MeterProvider: sliceMeterProvider{MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))}}
+
+	_ = testTools.WriteJSON(httptest.NewRecorder(), http.StatusOK, "ok")
+	_ = testTools.WriteJSON(httptest.NewRecorder(), http.StatusOK, "ok")
+
+	responses := collectMetric(t, reader, "toolkit.json.responses").(metricdata.Sum[int64])
+	if len(responses.DataPoints) != 1 || responses.DataPoints[0].Value != 2 {
+		t.Errorf("unexpected responses %+v", responses.DataPoints)
+	}
+}
+
+func TestTools_TelemetryInstrumentsOnce(t *testing.T) {
+	testTools, _, _ := newTelemetryTools()
+
+	first := testTools.observers()[0]
+	if second := testTools.observers()[0]; first != second {
+		t.Error("expected the instruments to be created once")
+	}
+}
+
+func TestTools_TelemetryDownloadAndTempDir(t *testing.T) {
+	testTools, spans, _ := newTelemetryTools()
+
+	rr := httptest.NewRecorder()
+	testTools.DownloadStaticFile(rr, httptest.NewRequest("GET", "/", nil), "./testdata", "missing.png", "missing.png")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, _, err := testTools.MkdirTemp(ctx, t.TempDir(), "stage-*"); err != nil {
+		t.Fatal(err)
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 2 || ended[0].Name() != "toolkit.DownloadStaticFile" || ended[1].Name() != "toolkit.MkdirTemp" {
+		t.Fatalf("unexpected spans %v", ended)
+	}
+	if ended[0].Status().Code != codes.Error {
+		t.Errorf("expected the missing file to fail the span, got %v", ended[0].Status())
+	}
+	for _, attr := range ended[0].Attributes() {
+		if attr.Key == "http.response.status_code" && attr.Value.AsInt64() != http.StatusNotFound {
+			t.Errorf("unexpected status attribute %v", attr.Value)
+		}
+	}
+}
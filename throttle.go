@@ -0,0 +1,202 @@
+package toolkit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// throttleChunkSize is the largest slice of a response written in one go, so
+// that downloads sharing the global budget interleave instead of taking turns
+const throttleChunkSize = 16 * 1024
+
+// DownloadThrottle limits the bandwidth and concurrency of DownloadStaticFile.
+// Assign a pointer to Tools.DownloadThrottle and share it between requests;
+// the zero value of any field disables that limit.
+type DownloadThrottle struct {
+	// BytesPerSecond caps the transfer rate of a single response
+	BytesPerSecond int64
+	// GlobalBytesPerSecond is the budget shared by every download using this throttle
+	GlobalBytesPerSecond int64
+	// MaxConcurrentPerClient caps the number of simultaneous downloads per client key
+	MaxConcurrentPerClient int
+	// ClientKey identifies the client of a request. By default the client IP is used
+	ClientKey func(r *http.Request) string
+	// TrustedProxies are the proxies whose X-Forwarded-For header is believed when
+	// finding the client IP; see ClientIP
+	TrustedProxies []netip.Prefix
+	// RetryAfter is sent in the Retry-After header of 429 responses. Defaults to 1 second
+	RetryAfter time.Duration
+
+	mu     sync.Mutex
+	active map[string]int
+	global *bandwidthBucket
+}
+
+// acquire reserves a download slot for key. It returns false when the client
+// is already at MaxConcurrentPerClient
+func (d *DownloadThrottle) acquire(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.active == nil {
+		d.active = make(map[string]int)
+	}
+	if d.MaxConcurrentPerClient > 0 && d.active[key] >= d.MaxConcurrentPerClient {
+		return false
+	}
+	d.active[key]++
+	return true
+}
+
+// release frees a slot taken by acquire
+func (d *DownloadThrottle) release(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.active[key]--
+	if d.active[key] <= 0 {
+		delete(d.active, key)
+	}
+}
+
+// globalBucket returns the bucket shared by all downloads, or nil when there is no global budget
+func (d *DownloadThrottle) globalBucket() *bandwidthBucket {
+	if d.GlobalBytesPerSecond <= 0 {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.global == nil || d.global.rate != d.GlobalBytesPerSecond {
+		d.global = &bandwidthBucket{rate: d.GlobalBytesPerSecond}
+	}
+	return d.global
+}
+
+// clientKey returns the key used to count concurrent downloads for r
+func (d *DownloadThrottle) clientKey(r *http.Request) string {
+	if d.ClientKey != nil {
+		return d.ClientKey(r)
+	}
+	return ClientIP(r, d.TrustedProxies...)
+}
+
+// retryAfter returns the value of the Retry-After header in whole seconds
+func (d *DownloadThrottle) retryAfter() string {
+	seconds := int(d.RetryAfter.Round(time.Second) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(seconds)
+}
+
+// serve wraps the serve function with the concurrency cap and the bandwidth limits
+func (d *DownloadThrottle) serve(t *Tools, w http.ResponseWriter, r *http.Request, serve func(http.ResponseWriter)) {
+	key := d.clientKey(r)
+	if !d.acquire(key) {
+		w.Header().Set("Retry-After", d.retryAfter())
+		_ = t.ErrorJSON(w, fmt.Errorf("too many concurrent downloads"), http.StatusTooManyRequests)
+		return
+	}
+	defer d.release(key)
+
+	tw := &throttledWriter{ResponseWriter: w, ctx: r.Context(), global: d.globalBucket()}
+	if d.BytesPerSecond > 0 {
+		tw.local = &bandwidthBucket{rate: d.BytesPerSecond}
+	}
+	serve(tw)
+}
+
+// bandwidthBucket is a token bucket measured in bytes. Writers take the bytes
+// they are about to send and sleep off any debt, so chunks larger than the
+// bucket are still allowed through at the configured rate.
+type bandwidthBucket struct {
+	mu     sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+// wait blocks until n bytes may be sent, or the context is done
+func (b *bandwidthBucket) wait(ctx context.Context, n int) error {
+	b.mu.Lock()
+	now := time.Now()
+	if b.last.IsZero() {
+		b.tokens = float64(b.rate)
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * float64(b.rate)
+		if b.tokens > float64(b.rate) {
+			b.tokens = float64(b.rate)
+		}
+	}
+	b.last = now
+	b.tokens -= float64(n)
+
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / float64(b.rate) * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// throttledWriter is a http.ResponseWriter that paces writes through its buckets.
+// It deliberately does not implement io.ReaderFrom, so http.ServeFile can't
+// bypass it with sendfile.
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx    context.Context
+	local  *bandwidthBucket
+	global *bandwidthBucket
+}
+
+// Write sends p in chunks, waiting on the per-response and global buckets before each one
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > throttleChunkSize {
+			chunk = chunk[:throttleChunkSize]
+		}
+
+		for _, b := range []*bandwidthBucket{tw.local, tw.global} {
+			if b == nil {
+				continue
+			}
+			if err := b.wait(tw.ctx, len(chunk)); err != nil {
+				return written, err
+			}
+		}
+
+		n, err := tw.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// Unwrap returns the original http.ResponseWriter, for http.ResponseController
+func (tw *throttledWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
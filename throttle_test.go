@@ -0,0 +1,88 @@
+package toolkit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTools_DownloadStaticFileConcurrencyLimit(t *testing.T) {
+	var testTools Tools
+	testTools.DownloadThrottle = &DownloadThrottle{MaxConcurrentPerClient: 1, RetryAfter: 5 * time.Second}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	// hold the only slot for this client
+	if !testTools.DownloadThrottle.acquire("10.0.0.1") {
+		t.Fatal("expected to acquire the first slot")
+	}
+
+	rr := httptest.NewRecorder()
+	testTools.DownloadStaticFile(rr, req, "./testdata/", "legion-xiii-logo.png", "logo.png")
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "5" {
+		t.Errorf("wrong Retry-After, got %q", rr.Header().Get("Retry-After"))
+	}
+	if rr.Header().Get("Content-Disposition") != "" {
+		t.Errorf("rejected download should not set Content-Disposition")
+	}
+
+	// another client is not affected
+	req.RemoteAddr = "10.0.0.2:1234"
+	rr = httptest.NewRecorder()
+	testTools.DownloadStaticFile(rr, req, "./testdata/", "legion-xiii-logo.png", "logo.png")
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	testTools.DownloadThrottle.release("10.0.0.1")
+	if len(testTools.DownloadThrottle.active) != 0 {
+		t.Errorf("expected no active downloads, got %v", testTools.DownloadThrottle.active)
+	}
+}
+
+func TestTools_DownloadStaticFileBandwidth(t *testing.T) {
+	var testTools Tools
+	testTools.DownloadThrottle = &DownloadThrottle{BytesPerSecond: 100000}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+
+	start := time.Now()
+	testTools.DownloadStaticFile(rr, req, "./testdata/", "legion-xiii-logo.png", "logo.png")
+	elapsed := time.Since(start)
+
+	// 148640 bytes at 100000 B/s with a one second burst needs roughly half a second
+	if elapsed < 400*time.Millisecond {
+		t.Errorf("download was not throttled, took %s", elapsed)
+	}
+
+	body, _ := io.ReadAll(rr.Result().Body)
+	if len(body) != 148640 {
+		t.Errorf("wrong body length, got %d", len(body))
+	}
+}
+
+func TestTools_DownloadStaticFileThrottledRange(t *testing.T) {
+	var testTools Tools
+	testTools.DownloadThrottle = &DownloadThrottle{BytesPerSecond: 1024, GlobalBytesPerSecond: 1024}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Range", "bytes=0-99")
+	rr := httptest.NewRecorder()
+
+	testTools.DownloadStaticFile(rr, req, "./testdata/", "legion-xiii-logo.png", "logo.png")
+
+	if rr.Code != http.StatusPartialContent {
+		t.Errorf("expected status %d, got %d", http.StatusPartialContent, rr.Code)
+	}
+	if rr.Body.Len() != 100 {
+		t.Errorf("expected 100 bytes, got %d", rr.Body.Len())
+	}
+}
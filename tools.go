@@ -2,19 +2,28 @@ package toolkit
 
 import (
 	"bytes"
-	"crypto/rand"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
-	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/charmbracelet/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const randomStringSource = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-+"
@@ -22,10 +31,29 @@ const randomStringSource = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ
 // Tools is the type we use to instantiate this module. Any variable of this
 // type will have access to all the methods with the receiver *Tools
 type Tools struct {
-	MaxFileSize        int
-	AllowedFileTypes   []string
-	MaxJSONSize        int
-	AllowUnknownFields bool
+	MaxFileSize           int
+	AllowedFileTypes      []string
+	MaxJSONSize           int
+	AllowUnknownFields    bool
+	DownloadThrottle      *DownloadThrottle
+	RenameFormat          IDFormat
+	UploadCollisionPolicy CollisionPolicy
+	QuotaStore            QuotaStore
+	QuotaKey              func(r *http.Request, uploadDir string) string
+	OnUploadProgress      func(UploadProgress)
+	SlugLanguage          string
+	UploadRules           map[string]UploadRule
+	SSEHeartbeat          time.Duration
+	CursorSecret          []byte
+	DefaultPageLimit      int
+	MaxPageLimit          int
+	Logger                *slog.Logger
+	TracerProvider        trace.TracerProvider
+	MeterProvider         metric.MeterProvider
+	Metrics               *MetricsRegistry
+
+	instrumentsOnce sync.Once
+	instruments     *otelInstruments
 }
 
 type JSONResponse struct {
@@ -34,15 +62,14 @@ type JSONResponse struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
-// RandomString returns a string of random characters of length n
+// RandomString returns a string of random characters of length n. Use GenerateRandomString
+// to pick another alphabet or to get an error instead of a panic when entropy isn't available.
 func (t *Tools) RandomString(n int) string {
-	s, r := make([]rune, n), []rune(randomStringSource)
-	for i := range s {
-		p, _ := rand.Prime(rand.Reader, len(r))
-		x, y := p.Uint64(), uint64(len(r))
-		s[i] = r[x%y]
+	s, err := t.GenerateRandomString(n)
+	if err != nil {
+		panic(err)
 	}
-	return string(s)
+	return s
 }
 
 // UploadedFile is a struct used to save information about an uploaded file
@@ -50,9 +77,35 @@ type UploadedFile struct {
 	NewFileName      string
 	OriginalFileName string
 	FileSize         int64
+	FieldName        string
+}
+
+// UploadResult is a struct used to return the files and the text fields of an upload form
+type UploadResult struct {
+	Files  []*UploadedFile
+	Fields url.Values
+}
+
+// Bind copies the text fields into the struct pointed to by dst, using `form:"name"` tags
+// with the same types and options as Tools.Bind
+func (u *UploadResult) Bind(dst any) error {
+	return bindValues(dst, "form", func(name string) ([]string, bool) {
+		values, ok := u.Fields[name]
+		return values, ok
+	})
 }
 
-// UploadFiles upload one or more files to a particular location
+// UploadFiles upload one or more files to a particular location. Renamed files get
+// a new name in the format given by t.RenameFormat. Files that aren't renamed keep
+// the client's name after SanitizeFilename, and t.UploadCollisionPolicy decides
+// what happens when that name is taken. If t.QuotaStore is set, the upload is rejected
+// with a *QuotaError before anything is written when it doesn't fit in the quota.
+// If t.OnUploadProgress is set, it is called as the request is received and written.
+// The files are checked against t.UploadRules and the allowed file types first, and an
+// *UploadRuleError lists every violation if any file breaks them. Accepted and rejected
+// uploads are logged to t.Logger, or slog.Default if it isn't set. Each file is written
+// under a staged .upload-*.part name and only renamed once complete, so the files a failed
+// request leaves behind are removed by CleanUploads.
 func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) ([]*UploadedFile, error) {
 
 	renameFile := true
@@ -60,25 +113,98 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 		renameFile = rename[0]
 	}
 
-	uploadedFiles := []*UploadedFile{}
+	return t.uploadFiles(r, uploadDir, renameFile, 0)
+}
+
+// uploadFiles does the work of UploadFiles, rejecting forms with more than maxFiles files if it's positive
+func (t *Tools) uploadFiles(r *http.Request, uploadDir string, renameFile bool, maxFiles int) (uploadedFiles []*UploadedFile, err error) {
+
+	uploadedFiles = []*UploadedFile{}
 
 	if t.MaxFileSize == 0 {
 		t.MaxFileSize = 1024 * 1024 * 1024 // 1GB
 	}
 
-	err := t.CreateDirIfNotExist(uploadDir)
+	err = t.CreateDirIfNotExist(uploadDir)
 	if err != nil {
 		return nil, err
 	}
 
+	progress := newUploadProgress(r, t.OnUploadProgress)
+	r.Body = progress.body(r.Body)
+	defer func() { progress.finish(err) }()
+
+	// Uploads stopped before anything is written are rejected: the form can't be read,
+	// breaks the rules or doesn't fit in the quota
+	ctx, span := t.startSpan(r.Context(), "toolkit.UploadFiles", attribute.String("upload.dir", uploadDir))
+	var writing bool
+	var written, replaced int64
+	defer func() {
+		logger := t.requestLogger(r).With("upload_dir", uploadDir)
+		switch {
+		case err == nil:
+			logger.Debug("upload accepted", "files", len(uploadedFiles), "bytes", written)
+			for _, o := range t.observers() {
+				o.uploadAccepted(ctx, len(uploadedFiles), written)
+			}
+		case !writing || clientErrorStatus(err) != 0:
+			logger.Warn("upload rejected", "error", err, "max_file_size", t.MaxFileSize)
+			reason := uploadRejectReason(err)
+			if r.MultipartForm == nil {
+				reason = uploadRejectForm
+			}
+			for _, o := range t.observers() {
+				o.uploadRejected(ctx, reason)
+			}
+		default:
+			logger.Error("upload failed", "error", err)
+		}
+		span.SetAttributes(attribute.Int("upload.files", len(uploadedFiles)), attribute.Int64("upload.bytes", written))
+		endSpan(span, err)
+	}()
+
 	err = r.ParseMultipartForm(int64(t.MaxFileSize))
 	if err != nil {
-		log.Error("File greater than 1GB")
 		return nil, err
 	}
 
+	// Check every file before writing any of them
+	err = t.validateUpload(r.MultipartForm, maxFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	var requested int64
 	for _, fHeaders := range r.MultipartForm.File {
 		for _, hdr := range fHeaders {
+			requested += hdr.Size
+		}
+	}
+	progress.writing(requested)
+
+	// Reserve quota for all the files before writing any of them, and settle it with what was written
+	if t.QuotaStore != nil {
+		key := t.quotaKey(r, uploadDir)
+
+		if err := t.QuotaStore.Reserve(key, requested); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if commitErr := t.QuotaStore.Commit(key, requested, written); commitErr != nil && err == nil {
+				err = commitErr
+			}
+			// Files that were overwritten no longer take up space
+			if replaced > 0 {
+				if freeErr := t.QuotaStore.Free(key, replaced); freeErr != nil && err == nil {
+					err = freeErr
+				}
+			}
+		}()
+	}
+
+	writing = true
+	for _, field := range slices.Sorted(maps.Keys(r.MultipartForm.File)) {
+		for _, hdr := range r.MultipartForm.File[field] {
 			uploadedFiles, err = func(uploadedFiles []*UploadedFile) ([]*UploadedFile, error) {
 				var uploadedFile UploadedFile
 
@@ -88,56 +214,55 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 				}
 				defer infile.Close()
 
-				buff := make([]byte, 512)
-				_, err = infile.Read(buff)
-				if err != nil {
-					return nil, err
-				}
-
-				// Check suffix
-				fileType := http.DetectContentType(buff)
-				allowed := false
-
-				if len(t.AllowedFileTypes) > 0 {
-					for _, x := range t.AllowedFileTypes {
-						if strings.EqualFold(fileType, x) {
-							allowed = true
-						}
+				if renameFile {
+					id, err := t.NewID(t.RenameFormat)
+					if err != nil {
+						return nil, err
 					}
+					uploadedFile.NewFileName = id + clientExtension(hdr.Filename)
 				} else {
-					allowed = true
+					// Client file names can't be trusted: strip paths, control characters and reserved names
+					uploadedFile.NewFileName, err = t.SanitizeFilename(hdr.Filename)
+					if err != nil {
+						return nil, err
+					}
 				}
 
-				if !allowed {
-					return nil, fmt.Errorf("File type not allowed: %s", fileType)
+				// The file is written under a staged name, and only gets its final one once complete
+				outfile, err := t.createStagedUpload(uploadDir)
+				if err != nil {
+					return nil, err
 				}
+				placed := false
+				defer func() {
+					_ = outfile.Close()
+					if !placed {
+						_ = os.Remove(outfile.Name())
+					}
+				}()
 
-				_, err = infile.Seek(0, 0)
+				fileSize, err := io.Copy(outfile, progress.file(infile, hdr.Filename, hdr.Size))
 				if err != nil {
 					return nil, err
 				}
-
-				if renameFile {
-					uploadedFile.NewFileName = fmt.Sprintf("%s%s", t.RandomString(25), filepath.Ext(hdr.Filename))
-				} else {
-					uploadedFile.NewFileName = hdr.Filename
+				if err := outfile.Close(); err != nil {
+					return nil, err
 				}
-				// The name
-				uploadedFile.OriginalFileName = hdr.Filename
-				var outfile *os.File
-				defer outfile.Close()
 
-				if outfile, err = os.Create(filepath.Join(uploadDir, uploadedFile.NewFileName)); err != nil {
+				// The name
+				var replacedSize int64
+				uploadedFile.NewFileName, replacedSize, err = t.placeUpload(uploadDir, outfile.Name(), uploadedFile.NewFileName)
+				if err != nil {
 					return nil, err
-				} else {
-					fileSize, err := io.Copy(outfile, infile)
-					if err != nil {
-						return nil, err
-					}
-					// The size
-					uploadedFile.FileSize = fileSize
 				}
+				placed = true
+				replaced += replacedSize
+
+				// The size
+				uploadedFile.FileSize = fileSize
+				written += fileSize
 				uploadedFile.OriginalFileName = hdr.Filename
+				uploadedFile.FieldName = field
 				uploadedFiles = append(uploadedFiles, &uploadedFile)
 				return uploadedFiles, nil
 			}(uploadedFiles)
@@ -150,7 +275,23 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 	return uploadedFiles, nil
 }
 
-// UploadOneFile upload one file to a particular location
+// UploadForm uploads the files of a multipart form like UploadFiles, and also returns
+// its text fields, such as a title or a description sent along with the files
+func (t *Tools) UploadForm(r *http.Request, uploadDir string, rename ...bool) (*UploadResult, error) {
+
+	uploadedFiles, err := t.UploadFiles(r, uploadDir, rename...)
+
+	result := &UploadResult{Files: uploadedFiles, Fields: url.Values{}}
+	if r.MultipartForm != nil {
+		for name, values := range r.MultipartForm.Value {
+			result.Fields[name] = values
+		}
+	}
+	return result, err
+}
+
+// UploadOneFile upload one file to a particular location. A request with more than one
+// file is rejected with an *UploadRuleError before anything is written
 func (t *Tools) UploadOneFile(r *http.Request, uploadDir string, rename ...bool) (*UploadedFile, error) {
 
 	renameFile := true
@@ -158,62 +299,215 @@ func (t *Tools) UploadOneFile(r *http.Request, uploadDir string, rename ...bool)
 		renameFile = rename[0]
 	}
 
-	uploadedFiles, err := t.UploadFiles(r, uploadDir, renameFile)
+	uploadedFiles, err := t.uploadFiles(r, uploadDir, renameFile, 1)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(uploadedFiles) > 1 {
-		return nil, fmt.Errorf("Only one file can be uploaded at a time")
+	if len(uploadedFiles) == 0 {
+		return nil, errors.New("no file was uploaded")
 	}
 	return uploadedFiles[0], nil
 }
 
-// CreateDirIfNotExist create a directory, and all parent directories if it doesn't exist
-func (t *Tools) CreateDirIfNotExist(path string) error {
+// DirOptions configures CreateDirIfNotExist
+type DirOptions struct {
+	// Mode of the directories that are created. Defaults to 0755
+	Mode os.FileMode
+	// IgnoreUmask sets created directories to exactly Mode, instead of Mode minus the process umask
+	IgnoreUmask bool
+	// Owner, if set, is applied to the directories that are created
+	Owner *FileOwner
+	// SkipWritableCheck skips checking that a file can be created in the directory
+	SkipWritableCheck bool
+}
+
+// FileOwner is a user and group ID pair, as used by os.Chown
+type FileOwner struct {
+	UID int
+	GID int
+}
+
+// CreateDirIfNotExist create a directory, and all parent directories if it doesn't exist.
+// It returns an error if path exists but isn't a directory, or if the directory isn't writable
+func (t *Tools) CreateDirIfNotExist(path string, opts ...DirOptions) error {
 
-	const mode = 0755
+	var o DirOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	mode := o.Mode
+	if mode == 0 {
+		mode = 0755
+	}
 
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		err := os.MkdirAll(path, mode)
-		if err != nil {
+	info, err := os.Stat(path)
+	switch {
+	case err == nil:
+		if !info.IsDir() {
+			return fmt.Errorf("%s exists and is not a directory", path)
+		}
+
+	case errors.Is(err, fs.ErrNotExist):
+		created := missingDirs(path)
+		if err := os.MkdirAll(path, mode); err != nil {
 			return err
 		}
+		for _, dir := range created {
+			if o.IgnoreUmask {
+				if err := os.Chmod(dir, mode); err != nil {
+					return err
+				}
+			}
+			if o.Owner != nil {
+				if err := os.Chown(dir, o.Owner.UID, o.Owner.GID); err != nil {
+					return err
+				}
+			}
+		}
+
+	default:
+		return err
 	}
-	return nil
+
+	if o.SkipWritableCheck {
+		return nil
+	}
+	return checkWritable(path)
 }
 
-// Slugify is a function that returns a slug given a string
-func (t *Tools) Slugify(s string) (string, error) {
+// missingDirs returns path and each of its parents that don't exist yet, outermost first
+func missingDirs(path string) []string {
+	var dirs []string
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		dirs = append([]string{dir}, dirs...)
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+	return dirs
+}
 
-	if s == "" {
-		return "", errors.New("empty string is not permitted")
+// checkWritable creates and removes a file in dir
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("directory %s is not writable: %w", dir, err)
+	}
+	name := f.Name()
+	_ = f.Close()
+	return os.Remove(name)
+}
+
+// MkdirTemp creates a new temporary directory in parent, like os.MkdirTemp, for staging
+// uploads. If parent is empty, os.TempDir is used. The directory and everything in it is
+// removed when ctx is done or when the returned cleanup function is called, whichever
+// comes first; calling cleanup more than once is safe
+func (t *Tools) MkdirTemp(ctx context.Context, parent, pattern string) (dir string, cleanup func() error, err error) {
+	_, span := t.startSpan(ctx, "toolkit.MkdirTemp", attribute.String("dir.parent", parent))
+	defer func() {
+		span.SetAttributes(attribute.String("dir.path", dir))
+		endSpan(span, err)
+	}()
+
+	if parent != "" {
+		if err := t.CreateDirIfNotExist(parent); err != nil {
+			return "", nil, err
+		}
 	}
 
-	re := regexp.MustCompile(`[^a-z0-9]+`)
-	slug := strings.Trim(re.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	dir, err = os.MkdirTemp(parent, pattern)
+	if err != nil {
+		return "", nil, err
+	}
 
-	if len(slug) == 0 {
-		return "", errors.New("after removing characters, slug is zero length")
+	var once sync.Once
+	var cleanupErr error
+	done := make(chan struct{})
+	cleanup = func() error {
+		once.Do(func() {
+			close(done)
+			cleanupErr = os.RemoveAll(dir)
+		})
+		return cleanupErr
 	}
-	return slug, nil
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = cleanup()
+		case <-done:
+		}
+	}()
+
+	return dir, cleanup, nil
+}
+
+// Slugify is a function that returns a slug given a string. Accented Latin, Cyrillic and Greek
+// letters are transliterated first, following the rules of t.SlugLanguage; see Transliterate.
+// Use SlugifyWithOptions for a custom separator, a length limit or stop-word removal
+func (t *Tools) Slugify(s string) (string, error) {
+	return t.SlugifyWithOptions(s, SlugOptions{})
 }
 
 // DownloadStaticFile downloads a file, or sends it to the client. It also force the browser to download the file
-// It also allows specification of the file name.
+// It also allows specification of the file name. If t.DownloadThrottle is set, the download is rate limited
+// and clients over the concurrency cap get a 429 response.
 func (t *Tools) DownloadStaticFile(w http.ResponseWriter, r *http.Request, p, file, displayName string) {
+	ctx, span := t.startSpan(r.Context(), "toolkit.DownloadStaticFile", attribute.String("file.name", file))
+	rw := newResponseRecorder(w)
+	defer func() {
+		span.SetAttributes(attribute.Int("http.response.status_code", rw.status), attribute.Int64("http.response.body.size", rw.bytes))
+		if rw.status >= http.StatusBadRequest {
+			span.SetStatus(codes.Error, http.StatusText(rw.status))
+		}
+		span.End()
+	}()
+	w = rw
+	r = r.WithContext(ctx)
 
 	// We do this to prevent directory traversal attacks and to ensure compatibility between Windows, Linux, and Mac
 	fp := path.Join(p, file)
 
-	// We want to download the file directly to the client, so we need to set the Content-Disposition header
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", displayName))
-	http.ServeFile(w, r, fp)
+	serve := func(w http.ResponseWriter) {
+		// We want to download the file directly to the client, so we need to set the Content-Disposition header
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", displayName))
+		http.ServeFile(w, r, fp)
+	}
+
+	if t.DownloadThrottle != nil {
+		t.DownloadThrottle.serve(t, w, r, serve)
+		return
+	}
+	serve(w)
 }
 
 // ReadJSON tries to read the body of a request and converts it into JSON.
-// If there is an error, we write the error in the response and return a 400 status code.
-func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data interface{}) error {
+// Problems with the body are returned as a *RequestError, with a 400 status code,
+// or 413 when the body is too large, and logged to t.Logger.
+func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data interface{}) (err error) {
+	_, span := t.startSpan(r.Context(), "toolkit.ReadJSON")
+	var decodeErr error
+	defer func() {
+		endSpan(span, err)
+		if err == nil {
+			return
+		}
+		for _, o := range t.observers() {
+			o.jsonReadFailed(r.Context(), jsonReadErrorType(decodeErr))
+		}
+
+		var requestError *RequestError
+		if errors.As(err, &requestError) {
+			t.requestLogger(r).Warn("json decode failed", "status", requestError.StatusCode(), "field", requestError.Field, "error", err)
+		} else {
+			t.requestLogger(r).Error("json decode failed", "error", err)
+		}
+	}()
 
 	maxBytes := 1024 * 1024 // 1MB
 	if t.MaxFileSize > 0 {
@@ -228,41 +522,42 @@ func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data interface{
 		dec.DisallowUnknownFields()
 	}
 
-	err := dec.Decode(data)
+	err = dec.Decode(data)
+	decodeErr = err
 
 	if err != nil {
 
 		var syntaxError *json.SyntaxError
 		var unmarshalTypeError *json.UnmarshalTypeError
 		var invalidUnmarshalError *json.InvalidUnmarshalError
+		var maxBytesError *http.MaxBytesError
 
 		switch {
 
 		case errors.As(err, &syntaxError):
-			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+			return &RequestError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)}
 
 		case errors.Is(err, io.ErrUnexpectedEOF):
-			return errors.New("body contains badly-formed JSON")
+			return &RequestError{Status: http.StatusBadRequest, Msg: "body contains badly-formed JSON"}
 
 		case errors.As(err, &unmarshalTypeError):
 			if unmarshalTypeError.Field != "" {
-				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+				return &RequestError{Status: http.StatusBadRequest, Field: unmarshalTypeError.Field, Msg: fmt.Sprintf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)}
 			}
-
-		case errors.As(err, &invalidUnmarshalError):
-			return fmt.Errorf("body contains incorrect JSON type (at character %d)", invalidUnmarshalError.Type.Bits())
+			return &RequestError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)}
 
 		case errors.Is(err, io.EOF):
-			return errors.New("body must not be empty")
+			return &RequestError{Status: http.StatusBadRequest, Msg: "body must not be empty"}
 
 		case strings.HasPrefix(err.Error(), "json: unknown field "):
 			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
-			return fmt.Errorf("body contains unknown key %s", fieldName)
+			return &RequestError{Status: http.StatusBadRequest, Field: strings.Trim(fieldName, `"`), Msg: fmt.Sprintf("body contains unknown key %s", fieldName)}
 
-		case err.Error() == "http: request body too large":
-			return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+		case errors.As(err, &maxBytesError):
+			return &RequestError{Status: http.StatusRequestEntityTooLarge, Msg: fmt.Sprintf("body must not be larger than %d bytes", maxBytes)}
 
 		case errors.As(err, &invalidUnmarshalError):
+			// The destination isn't a pointer: a bug in the caller, not in the request
 			return fmt.Errorf("error unmarshalling JSON: %s", err.Error())
 
 		default:
@@ -273,12 +568,13 @@ func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data interface{
 	// It will try to decode more JSON from that fail
 	err = dec.Decode(&struct{}{})
 	if err != io.EOF {
-		return errors.New("body must only contain a single JSON value")
+		return &RequestError{Status: http.StatusBadRequest, Msg: "body must only contain a single JSON value"}
 	}
 	return nil
 }
 
-// WriteJSON tries to write the response as JSON.
+// WriteJSON tries to write the response as JSON. The headers passed replace the ones
+// already set, except Vary, which is added to.
 func (t *Tools) WriteJSON(w http.ResponseWriter, status int, data interface{}, headers ...http.Header) error {
 	out, err := json.Marshal(data)
 	if err != nil {
@@ -286,11 +582,19 @@ func (t *Tools) WriteJSON(w http.ResponseWriter, status int, data interface{}, h
 	}
 	if len(headers) > 0 {
 		for key, value := range headers[0] {
+			// Vary is added to, so the values set by middleware such as CORS are kept
+			if http.CanonicalHeaderKey(key) == "Vary" {
+				addVary(w.Header(), splitHeaderList(value)...)
+				continue
+			}
 			w.Header()[key] = value
 		}
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
+	for _, o := range t.observers() {
+		o.responseWritten(status)
+	}
 	_, err = w.Write(out)
 	if err != nil {
 		return err
@@ -298,12 +602,16 @@ func (t *Tools) WriteJSON(w http.ResponseWriter, status int, data interface{}, h
 	return nil
 }
 
-// Error JSON takes an error and a status code, and writes a JOSN error message to the client
+// Error JSON takes an error and a status code, and writes a JOSN error message to the client.
+// Without a status code, errors with a StatusCode method, such as *RequestError, choose their own.
 func (t *Tools) ErrorJSON(w http.ResponseWriter, err error, status ...int) error {
 
 	statusCode := http.StatusBadRequest
+	var coder statusCoder
 	if len(status) > 0 {
 		statusCode = status[0]
+	} else if errors.As(err, &coder) {
+		statusCode = coder.StatusCode()
 	}
 	payload := JSONResponse{
 		Error:   true,
@@ -315,12 +623,12 @@ func (t *Tools) ErrorJSON(w http.ResponseWriter, err error, status ...int) error
 // PushJSONToRemote pushes arbitrary JSON data to a remote endpoint and returns the response, status code, and error if any
 // The final parameter is an optional http client. If none is specified, we use the standard http.Client
 func (t *Tools) PushJSONToRemote(uri string, data interface{}, client ...*http.Client) (*http.Response, int, error) {
-	// create json
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return nil, 0, err
-	}
+	return t.PushJSONToRemoteContext(context.Background(), uri, data, client...)
+}
 
+// PushJSONToRemoteContext is PushJSONToRemote with a context, which cancels the request and
+// carries the trace that the push belongs to. The trace context is sent to the remote service.
+func (t *Tools) PushJSONToRemoteContext(ctx context.Context, uri string, data any, client ...*http.Client) (*http.Response, int, error) {
 	// checks for custom http client
 	httpClient := &http.Client{}
 
@@ -328,15 +636,7 @@ func (t *Tools) PushJSONToRemote(uri string, data interface{}, client ...*http.C
 		httpClient = client[0]
 	}
 
-	// create request
-	req, err := http.NewRequest("POST", uri, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, 0, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	// send request
-	resp, err := httpClient.Do(req)
+	resp, err := t.pushJSON(ctx, uri, data, httpClient)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -347,3 +647,42 @@ func (t *Tools) PushJSONToRemote(uri string, data interface{}, client ...*http.C
 	// send response back
 	return resp, resp.StatusCode, nil
 }
+
+// pushJSON posts data as JSON to uri and returns the response. The caller must close its body
+func (t *Tools) pushJSON(ctx context.Context, uri string, data any, httpClient *http.Client) (resp *http.Response, err error) {
+	ctx, span := t.startSpan(ctx, "toolkit.PushJSONToRemote")
+	defer func() { endSpan(span, err) }()
+
+	// create json
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// create request
+	req, err := http.NewRequestWithContext(ctx, "POST", uri, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	span.SetAttributes(attribute.String("url.full", req.URL.Redacted()))
+
+	// send request
+	start := time.Now()
+	resp, err = t.instrumentedClient(httpClient).Do(req)
+	latency := time.Since(start)
+	logger := t.contextLogger(ctx).With("uri", req.URL.Redacted(), "bytes", len(jsonData), "latency", latency)
+	if err != nil {
+		logger.Error("remote push failed", "error", err)
+		for _, o := range t.observers() {
+			o.remotePushed(ctx, 0, err, latency)
+		}
+		return nil, err
+	}
+	logger.Debug("remote push", "status", resp.StatusCode)
+	for _, o := range t.observers() {
+		o.remotePushed(ctx, resp.StatusCode, nil, latency)
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	return resp, nil
+}
@@ -2,6 +2,7 @@ package toolkit
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,9 +14,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 var uploadTests = []struct {
@@ -40,6 +44,10 @@ var slugsTests = []struct {
 	{name: "underscore", s: "_", expected: "", errorExpected: true},
 	{name: "two words", s: "abc def", expected: "abc-def", errorExpected: false},
 	{name: "two words with spaces", s: "abc def ghi", expected: "abc-def-ghi", errorExpected: false},
+	{name: "accents", s: "Café Crème", expected: "cafe-creme", errorExpected: false},
+	{name: "cyrillic", s: "Привет, мир", expected: "privet-mir", errorExpected: false},
+	{name: "greek", s: "Καλημέρα κόσμε", expected: "kalimera-kosme", errorExpected: false},
+	{name: "japanese", s: "こんにちは", expected: "", errorExpected: true},
 }
 
 var jsonTests = []struct {
@@ -218,6 +226,38 @@ func TestTools_UploadOneFile(t *testing.T) {
 		t.Errorf("%s: no error expected but got one", err)
 	}
 }
+func TestTools_UploadForm(t *testing.T) {
+	var testTools Tools
+
+	request := newUploadRequest(t,
+		map[string]string{"title": "Holiday", "album": "7"},
+		testUploadFile{field: "cover", name: "cover.png", contents: testPNG(t)},
+		testUploadFile{field: "photos", name: "one.png", contents: testPNG(t)},
+	)
+
+	result, err := testTools.UploadForm(request, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Files) != 2 || result.Files[0].FieldName != "cover" || result.Files[1].FieldName != "photos" {
+		t.Errorf("expected the files with their field names, got %+v %+v", result.Files[0], result.Files[1])
+	}
+	if result.Fields.Get("title") != "Holiday" {
+		t.Errorf("expected the title field, got %v", result.Fields)
+	}
+
+	var form struct {
+		Title string `form:"title"`
+		Album int    `form:"album"`
+	}
+	if err := result.Bind(&form); err != nil {
+		t.Fatal(err)
+	}
+	if form.Title != "Holiday" || form.Album != 7 {
+		t.Errorf("unexpected bound values %+v", form)
+	}
+}
 func TestTools_CreateDirIfNotExist(t *testing.T) {
 	var testTools Tools
 	err := testTools.CreateDirIfNotExist("./testdata/uploads/")
@@ -232,6 +272,86 @@ func TestTools_CreateDirIfNotExist(t *testing.T) {
 
 	_ = os.Remove("./testdata/uploads")
 }
+func TestTools_CreateDirIfNotExistOptions(t *testing.T) {
+	var testTools Tools
+	root := t.TempDir()
+
+	// a regular file where the directory should be
+	file := filepath.Join(root, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := testTools.CreateDirIfNotExist(file); err == nil {
+		t.Error("expected an error when the path is a regular file")
+	}
+
+	// the mode is applied to every created directory, ignoring the umask
+	nested := filepath.Join(root, "a", "b")
+	if err := testTools.CreateDirIfNotExist(nested, DirOptions{Mode: 0777, IgnoreUmask: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{filepath.Join(root, "a"), nested} {
+		info, err := os.Stat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0777 {
+			t.Errorf("expected mode 0777 for %s, got %o", dir, info.Mode().Perm())
+		}
+	}
+
+	// the owner can be set to the current user, except on Windows where there are no user IDs
+	if runtime.GOOS != "windows" {
+		owned := filepath.Join(root, "owned")
+		if err := testTools.CreateDirIfNotExist(owned, DirOptions{Owner: &FileOwner{UID: os.Getuid(), GID: os.Getgid()}}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// the writable check leaves nothing behind
+	entries, _ := os.ReadDir(nested)
+	if len(entries) != 0 {
+		t.Errorf("expected an empty directory, got %d entries", len(entries))
+	}
+}
+func TestTools_MkdirTemp(t *testing.T) {
+	var testTools Tools
+	parent := filepath.Join(t.TempDir(), "staging")
+
+	// removed by the cleanup function
+	dir, cleanup, err := testTools.MkdirTemp(context.Background(), parent, "upload-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "part"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cleanup(); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed", dir)
+	}
+	if err := cleanup(); err != nil {
+		t.Errorf("second cleanup failed: %s", err)
+	}
+
+	// removed when the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	dir, _, err = testTools.MkdirTemp(ctx, parent, "upload-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("expected %s to be removed after the context was cancelled", dir)
+}
 func TestTools_Slugify(t *testing.T) {
 	var testTools Tools
 	for _, e := range slugsTests {
@@ -382,6 +502,32 @@ func TestTools_ErrorJSON(t *testing.T) {
 	}
 }
 
+func TestTools_ErrorJSONStatusCode(t *testing.T) {
+	testTools := Tools{MaxFileSize: 8}
+
+	// the status of a *RequestError is used when none is given
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"foo": "a long value"}`))
+	err := testTools.ReadJSON(httptest.NewRecorder(), req, &struct{ Foo string }{})
+
+	var requestErr *RequestError
+	if !errors.As(err, &requestErr) {
+		t.Fatalf("expected a *RequestError, got %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	_ = testTools.ErrorJSON(rr, err)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status code %d, got %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+
+	// a given status wins
+	rr = httptest.NewRecorder()
+	_ = testTools.ErrorJSON(rr, err, http.StatusTeapot)
+	if rr.Code != http.StatusTeapot {
+		t.Errorf("expected status code %d, got %d", http.StatusTeapot, rr.Code)
+	}
+}
+
 func TestTools_PushJSONToRemote(t *testing.T) {
 	client := NewTestClient(func(req *http.Request) *http.Response {
 		return &http.Response{
@@ -404,3 +550,53 @@ func TestTools_PushJSONToRemote(t *testing.T) {
 		t.Errorf("failed to push JSON: %v", err)
 	}
 }
+
+// testUploadFile is a file part sent by newUploadRequest
+type testUploadFile struct {
+	field    string
+	name     string
+	contents []byte
+}
+
+// newUploadRequest builds a multipart request with the given text fields and files
+func newUploadRequest(t *testing.T, fields map[string]string, files ...testUploadFile) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, f := range files {
+		part, err := writer.CreateFormFile(f.field, f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := part.Write(f.contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	request := httptest.NewRequest("POST", "/", &body)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+	return request
+}
+
+// testPNG returns the contents of the test image
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+
+	contents, err := os.ReadFile("./testdata/legion-xiii-logo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
@@ -0,0 +1,119 @@
+package toolkit
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// latinTransliterations maps lower case Latin letters with diacritics, ligatures
+// and special letters to ASCII
+var latinTransliterations = runeTable(map[string]string{
+	"àáâãäåāăąǎǻạảấầẩẫậắằẳẵặ": "a", "çćĉċč": "c", "ďđ": "d", "èéêëēĕėęěẹẻẽếềểễệ": "e",
+	"ĝğġģ": "g", "ĥħ": "h", "ìíîïĩīĭįıǐỉị": "i", "ĵ": "j", "ķ": "k", "ĺļľŀł": "l", "ñńņňŉ": "n",
+	"òóôõöøōŏőơǒǿọỏốồổỗộớờởỡợ": "o", "ŕŗř": "r", "śŝşšș": "s", "ţťŧț": "t",
+	"ùúûüũūŭůűųưǔǖǘǚǜụủứừửữự": "u", "ŵ": "w", "ýÿŷỳỵỷỹ": "y", "źżž": "z",
+	"æǽ": "ae", "œ": "oe", "ß": "ss", "þ": "th", "ð": "d", "ĳ": "ij",
+})
+
+// cyrillicTransliterations maps lower case Cyrillic letters to ASCII, following
+// Russian conventions and covering the extra letters of other Cyrillic alphabets
+var cyrillicTransliterations = runeTable(map[string]string{
+	"а": "a", "б": "b", "в": "v", "г": "g", "д": "d", "е": "e", "ё": "yo", "ж": "zh",
+	"з": "z", "и": "i", "й": "y", "к": "k", "л": "l", "м": "m", "н": "n", "о": "o",
+	"п": "p", "р": "r", "с": "s", "т": "t", "у": "u", "ф": "f", "х": "kh", "ц": "ts",
+	"ч": "ch", "ш": "sh", "щ": "shch", "ъ": "", "ы": "y", "ь": "", "э": "e", "ю": "yu",
+	"я": "ya", "є": "ye", "і": "i", "ї": "yi", "ґ": "g", "ў": "u", "ђ": "dj", "ј": "j",
+	"љ": "lj", "њ": "nj", "ћ": "c", "џ": "dz", "ѓ": "gj", "ќ": "kj", "ѕ": "dz",
+})
+
+// greekTransliterations maps lower case Greek letters, with and without tonos, to ASCII
+var greekTransliterations = runeTable(map[string]string{
+	"αά": "a", "β": "v", "γ": "g", "δ": "d", "εέ": "e", "ζ": "z", "ηή": "i", "θ": "th",
+	"ιίϊΐ": "i", "κ": "k", "λ": "l", "μ": "m", "ν": "n", "ξ": "x", "οό": "o", "π": "p",
+	"ρ": "r", "σς": "s", "τ": "t", "υύϋΰ": "y", "φ": "f", "χ": "ch", "ψ": "ps", "ωώ": "o",
+})
+
+// greekDigraphs are letter pairs transliterated together, applied before single letters
+var greekDigraphs = strings.NewReplacer("ου", "ou", "ού", "ou", "αυ", "av", "αύ", "av", "ευ", "ev", "εύ", "ev")
+
+// languageTransliterations holds the rules that differ from the defaults, by language code
+var languageTransliterations = map[string]map[rune]string{
+	// German: umlauts are written out
+	"de": runeTable(map[string]string{"ä": "ae", "ö": "oe", "ü": "ue"}),
+	// Danish and Norwegian
+	"da": runeTable(map[string]string{"æ": "ae", "ø": "oe", "å": "aa"}),
+	"no": runeTable(map[string]string{"æ": "ae", "ø": "oe", "å": "aa"}),
+	"nb": runeTable(map[string]string{"æ": "ae", "ø": "oe", "å": "aa"}),
+	"nn": runeTable(map[string]string{"æ": "ae", "ø": "oe", "å": "aa"}),
+	// Ukrainian national transliteration, with wordInitialTransliterations
+	"uk": runeTable(map[string]string{
+		"г": "h", "и": "y", "х": "kh", "щ": "shch",
+		"є": "ie", "ї": "i", "й": "i", "ю": "iu", "я": "ia",
+	}),
+	// Bulgarian streamlined system
+	"bg": runeTable(map[string]string{"щ": "sht", "ъ": "a", "х": "h", "ю": "yu", "я": "ya"}),
+}
+
+// wordInitialTransliterations holds the rules for letters at the start of a word, by
+// language code, where they differ from the rules for the rest of the word
+var wordInitialTransliterations = map[string]map[rune]string{
+	"uk": runeTable(map[string]string{"є": "ye", "ї": "yi", "й": "y", "ю": "yu", "я": "ya"}),
+}
+
+// runeTable expands a map whose keys are sets of runes into a map from each rune
+func runeTable(m map[string]string) map[rune]string {
+	table := make(map[rune]string)
+	for runes, replacement := range m {
+		for _, r := range runes {
+			table[r] = replacement
+		}
+	}
+	return table
+}
+
+// Transliterate lower cases s and converts Latin, Cyrillic and Greek letters to
+// ASCII, using the rules of t.SlugLanguage (an ISO 639-1 code such as "de") where
+// they differ from the defaults. Characters from other scripts are left as they are.
+func (t *Tools) Transliterate(s string) string {
+	return transliterate(s, t.SlugLanguage)
+}
+
+// transliterate implements Transliterate for the given language
+func transliterate(s, lang string) string {
+	s = greekDigraphs.Replace(strings.ToLower(s))
+	overrides := languageTransliterations[strings.ToLower(lang)]
+	initials := wordInitialTransliterations[strings.ToLower(lang)]
+
+	var b strings.Builder
+	b.Grow(len(s))
+	wordStart := true
+	for _, r := range s {
+		atWordStart := wordStart
+		// An apostrophe, as in "м'ясо", doesn't start a new word
+		wordStart = !unicode.IsLetter(r) && !strings.ContainsRune("'’ʼ", r)
+
+		if r < utf8.RuneSelf {
+			b.WriteRune(r)
+			continue
+		}
+
+		if replacement, ok := initials[r]; ok && atWordStart {
+			b.WriteString(replacement)
+		} else if replacement, ok := overrides[r]; ok {
+			b.WriteString(replacement)
+		} else if replacement, ok := latinTransliterations[r]; ok {
+			b.WriteString(replacement)
+		} else if replacement, ok := cyrillicTransliterations[r]; ok {
+			b.WriteString(replacement)
+		} else if replacement, ok := greekTransliterations[r]; ok {
+			b.WriteString(replacement)
+		} else if unicode.Is(unicode.Mn, r) {
+			// Combining marks from decomposed input, like the accent in "é"
+			continue
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
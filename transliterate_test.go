@@ -0,0 +1,35 @@
+package toolkit
+
+import "testing"
+
+var transliterateTests = []struct {
+	name     string
+	s        string
+	language string
+	expected string
+}{
+	{name: "french", s: "Crème Brûlée", expected: "creme brulee"},
+	{name: "decomposed accents", s: "Cafe\u0301", expected: "cafe"},
+	{name: "german default", s: "Größe Übung", expected: "grosse ubung"},
+	{name: "german rules", s: "Größe Übung", language: "de", expected: "groesse uebung"},
+	{name: "norwegian default", s: "Blåbærsyltetøy", expected: "blabaersyltetoy"},
+	{name: "norwegian rules", s: "Blåbærsyltetøy", language: "nb", expected: "blaabaersyltetoey"},
+	{name: "polish", s: "Łódź", expected: "lodz"},
+	{name: "russian", s: "Щука и Ёж", expected: "shchuka i yozh"},
+	{name: "ukrainian rules", s: "Київ Харків", language: "uk", expected: "kyiv kharkiv"},
+	{name: "ukrainian word start", s: "Юрій Єрмак, Яготин", language: "uk", expected: "yurii yermak, yahotyn"},
+	{name: "ukrainian apostrophe", s: "Мар'янівка", language: "uk", expected: "mar'ianivka"},
+	{name: "bulgarian rules", s: "България", language: "bg", expected: "balgariya"},
+	{name: "greek", s: "Αθήνα", expected: "athina"},
+	{name: "greek digraph", s: "Κουλούρι", expected: "koulouri"},
+	{name: "untouched script", s: "東京", expected: "東京"},
+}
+
+func TestTools_Transliterate(t *testing.T) {
+	for _, e := range transliterateTests {
+		testTools := Tools{SlugLanguage: e.language}
+		if got := testTools.Transliterate(e.s); got != e.expected {
+			t.Errorf("%s: expected %q, got %q", e.name, e.expected, got)
+		}
+	}
+}